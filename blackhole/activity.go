@@ -0,0 +1,59 @@
+package blackhole
+
+import (
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+var (
+	// LAST_ACTIVITY has the timestamp of the latest message in each
+	// channel, which is the base of TTLs with ttl_after_inactivity.
+	LAST_ACTIVITY      = make(map[string]string)
+	LAST_ACTIVITY_LOCK sync.Mutex
+)
+
+// newerTimestamp returns true if Slack timestamp a is newer than b.
+func newerTimestamp(a, b string) bool {
+	ta, err := unixTime(a)
+	if err != nil {
+		return false
+	}
+	tb, err := unixTime(b)
+	if err != nil {
+		return true
+	}
+	return ta.After(tb)
+}
+
+// touchChannel records ts as an activity in ch.
+func touchChannel(ch, ts string) {
+	if ts == "" {
+		return
+	}
+	LAST_ACTIVITY_LOCK.Lock()
+	defer LAST_ACTIVITY_LOCK.Unlock()
+	if newerTimestamp(ts, LAST_ACTIVITY[ch]) {
+		LAST_ACTIVITY[ch] = ts
+	}
+}
+
+// touchChannelHistory records the latest activity in msgs.  Thread replies
+// are counted only if the history has them.  Posts of slack-blackhole like
+// summaries are not activities.
+func touchChannelHistory(ch string, msgs []slack.Message) {
+	for i := range msgs {
+		if !ownMessage(&msgs[i]) {
+			touchChannel(ch, msgs[i].Timestamp)
+		}
+		for _, r := range msgs[i].Replies {
+			touchChannel(ch, r.Timestamp)
+		}
+	}
+}
+
+func lastActivity(ch string) string {
+	LAST_ACTIVITY_LOCK.Lock()
+	defer LAST_ACTIVITY_LOCK.Unlock()
+	return LAST_ACTIVITY[ch]
+}
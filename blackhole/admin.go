@@ -0,0 +1,310 @@
+package blackhole
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const adminHelp = "Usage:\n" +
+	"  status [#channel]\n" +
+	"  ttl #channel <message-ttl> [<file-ttl>]\n" +
+	"  pause #channel\n" +
+	"  resume #channel\n" +
+	"  retry-failed\n" +
+	"  stats [#channel]\n" +
+	"TTLs are seconds or durations like 10m, 12h or 7d.  0 means the default TTL."
+
+var channelLinkRe = regexp.MustCompile(`^<#([A-Z0-9]+)(?:\|([^>]*))?>$`)
+
+func isAdmin(user string) (bool, error) {
+	waitAPI("users.info")
+	u, err := RTM.GetUserInfo(user)
+	if err != nil {
+		return false, fmt.Errorf("GetUserInfo(%s): %w", user, err)
+	}
+	return u.IsAdmin || u.IsOwner || u.IsPrimaryOwner, nil
+}
+
+// resolveChannel returns the ID and the name of the channel specified as
+// "<#C0123|name>", "#name" or "name".
+func resolveChannel(s string) (string, string, error) {
+	if m := channelLinkRe.FindStringSubmatch(s); m != nil {
+		if m[2] != "" {
+			return m[1], m[2], nil
+		}
+		waitAPI("conversations.info")
+		ch, err := RTM.GetConversationInfo(m[1], false)
+		if err != nil {
+			return "", "", fmt.Errorf("GetConversationInfo(%s): %w", m[1], err)
+		}
+		return ch.ID, ch.Name, nil
+	}
+	name := strings.TrimPrefix(s, "#")
+	channels, err := BACKEND.ListConversations()
+	if err != nil {
+		return "", "", err
+	}
+	for _, ch := range channels {
+		if ch.Name == name {
+			return ch.ID, ch.Name, nil
+		}
+	}
+	return "", "", fmt.Errorf("channel not found: %s", s)
+}
+
+func formatTTL(ttl int) string {
+	if ttl == 0 {
+		return "none"
+	}
+	return (time.Duration(ttl) * time.Second).String()
+}
+
+func effectiveTTL(cfgttl, defttl int) int {
+	if cfgttl > 0 {
+		return cfgttl
+	}
+	return defttl
+}
+
+func adminStatus(args []string) (string, error) {
+	if len(args) == 0 {
+		CONFIG_LOCK.RLock()
+		n := len(CONFIG_BY_ID)
+		CONFIG_LOCK.RUnlock()
+		return fmt.Sprintf("default message TTL: %s\ndefault file TTL: %s\nconfigured channels: %d\ndry-run: %v",
+			formatTTL(DEFAULT_MESSAGE_TTL), formatTTL(DEFAULT_FILE_TTL), n, DRY_RUN), nil
+	}
+	id, name, err := resolveChannel(args[0])
+	if err != nil {
+		return "", err
+	}
+	reply := fmt.Sprintf("#%s: message TTL: %s, file TTL: %s", name,
+		formatTTL(POLICY.MessageTTL(id)), formatTTL(POLICY.FileTTL(id)))
+	if !POLICY.Managed(id) {
+		reply += " (not managed)"
+	}
+	if isPaused(id) {
+		reply += " (paused)"
+	}
+	return reply, nil
+}
+
+func adminPause(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("wrong number of arguments")
+	}
+	id, name, err := resolveChannel(args[0])
+	if err != nil {
+		return "", err
+	}
+	if !pauseChannel(id) {
+		return fmt.Sprintf("#%s is already paused", name), nil
+	}
+	return fmt.Sprintf("#%s is paused.  Deletions are postponed until it is resumed.", name), nil
+}
+
+func adminResume(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("wrong number of arguments")
+	}
+	id, name, err := resolveChannel(args[0])
+	if err != nil {
+		return "", err
+	}
+	if !resumeChannel(id) {
+		return fmt.Sprintf("#%s is not paused", name), nil
+	}
+	return fmt.Sprintf("#%s is resumed.  Postponed deletions are executed now.", name), nil
+}
+
+func adminTTL(args []string) (string, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return "", fmt.Errorf("wrong number of arguments")
+	}
+	id, name, err := resolveChannel(args[0])
+	if err != nil {
+		return "", err
+	}
+	d, err := parseDuration(args[1])
+	if err != nil {
+		return "", err
+	}
+	messageTTL := int(d / time.Second)
+	var fileTTL *int
+	if len(args) == 3 {
+		d, err = parseDuration(args[2])
+		if err != nil {
+			return "", err
+		}
+		t := int(d / time.Second)
+		fileTTL = &t
+	}
+	if err := checkMinTTLs(&messageTTL, fileTTL); err != nil {
+		return "", err
+	}
+	cfg, err := updateChannelTTL(id, name, &messageTTL, fileTTL)
+
+	reply := fmt.Sprintf("#%s: message TTL: %s, file TTL: %s (applies to new messages/files and the next sweep)",
+		name, formatTTL(cfg.MessageTTL), formatTTL(cfg.FileTTL))
+	if err != nil {
+		return reply + "\nSaving the config file failed: " + err.Error(), nil
+	}
+	if ADMIN_PERSIST_CONFIG {
+		reply += "\nSaved to the config file."
+	}
+	return reply, nil
+}
+
+// updateChannelTTL updates the TTLs of the channel.  nil leaves the TTL
+// unchanged.  The config file is saved if ADMIN_PERSIST_CONFIG is set.  The
+// error is about saving; the TTLs are updated even if it is not nil.
+func updateChannelTTL(id, name string, messageTTL, fileTTL *int) (Config, error) {
+	cfg := channelConfig(id)
+	cfg.Channel = name
+	cfg.fromEnv = false
+	cfg.fileConfig = nil
+	if messageTTL != nil {
+		cfg.MessageTTL = *messageTTL
+	}
+	if fileTTL != nil {
+		cfg.FileTTL = *fileTTL
+	}
+	setChannelConfig(id, cfg)
+	info("CONFIG_BY_ID[%s]: %v (by admin)", id, cfg)
+	if ADMIN_PERSIST_CONFIG {
+		if err := saveConfig(); err != nil {
+			errorlog("saveConfig() failed: %v", err)
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+// runAdminCommand runs an admin command issued by user and returns the reply
+// to the user.
+func runAdminCommand(user, text string) string {
+	ok, err := isAdmin(user)
+	if err != nil {
+		errorlog("isAdmin(%s) failed: %v", user, err)
+		return "Error: " + err.Error()
+	}
+	if !ok {
+		info("Admin command from non-admin user %s is rejected: %s", user, text)
+		return "Only workspace admins can use this command."
+	}
+	info("Admin command from %s: %s", user, text)
+
+	args := strings.Fields(text)
+	if len(args) > 0 && (args[0] == "blackhole" || args[0] == "/blackhole") {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return adminHelp
+	}
+	var reply string
+	switch args[0] {
+	case "status":
+		reply, err = adminStatus(args[1:])
+	case "ttl":
+		reply, err = adminTTL(args[1:])
+	case "pause":
+		reply, err = adminPause(args[1:])
+	case "resume":
+		reply, err = adminResume(args[1:])
+	case "retry-failed":
+		reply, err = adminRetryFailed(args[1:])
+	case "stats":
+		reply, err = adminStats(args[1:])
+	default:
+		return adminHelp
+	}
+	if err != nil {
+		return "Error: " + err.Error() + "\n" + adminHelp
+	}
+	return reply
+}
+
+// handleDirectMessage handles a message in a DM with the bot as an admin
+// command.
+func handleDirectMessage(msg *slack.MessageEvent) {
+	if msg.SubType != "" || msg.User == "" || msg.User == SELF_USER_ID {
+		return
+	}
+	reply := runAdminCommand(msg.User, msg.Text)
+	waitAPI("chat.postMessage")
+	_, _, err := RTM.PostMessage(msg.Channel, slack.MsgOptionText(reply, false))
+	if err != nil {
+		errorlog("PostMessage(%s) failed: %v", msg.Channel, err)
+	}
+}
+
+// verifySlackRequest reads the body of r and verifies its signature with
+// SLACK_SIGNING_SECRET.  It writes an error response and returns false if
+// the request is not from Slack.
+func verifySlackRequest(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	sv, err := slack.NewSecretsVerifier(r.Header, SLACK_SIGNING_SECRET)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+	sv.Write(body)
+	if err := sv.Ensure(); err != nil {
+		errorlog("Request to %s with invalid signature: %v", r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+	return body, true
+}
+
+func handleSlashCommand(w http.ResponseWriter, r *http.Request) {
+	body, ok := verifySlackRequest(w, r)
+	if !ok {
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	cmd, err := slack.SlashCommandParse(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Slack requires a response in 3 seconds but API calls in the command
+	// are throttled.  Reply later via response_url.
+	go func() {
+		reply := runAdminCommand(cmd.UserID, cmd.Text)
+		err := slack.PostWebhook(cmd.ResponseURL, &slack.WebhookMessage{Text: reply})
+		if err != nil {
+			errorlog("PostWebhook(response_url) failed: %v", err)
+		}
+	}()
+	w.WriteHeader(http.StatusOK)
+}
+
+func initSlashCommand() {
+	if SLASH_COMMAND_ADDR == "" {
+		return
+	}
+	if SLACK_SIGNING_SECRET == "" {
+		fatal("BLACKHOLE_SLACK_SIGNING_SECRET is not set")
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slack/command", handleSlashCommand)
+	mux.HandleFunc("/slack/interactivity", handleInteraction)
+	go func() {
+		info("Listening slash commands and interactions on %s", SLASH_COMMAND_ADDR)
+		err := http.ListenAndServe(SLASH_COMMAND_ADDR, mux)
+		fatal("ListenAndServe(%s) failed: %v", SLASH_COMMAND_ADDR, err)
+	}()
+}
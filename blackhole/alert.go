@@ -0,0 +1,100 @@
+package blackhole
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+type alertPayload struct {
+	Text string `json:"text"`
+	Time string `json:"time"`
+	logFields
+}
+
+var (
+	alertClient = &http.Client{Timeout: 10 * time.Second}
+
+	// deletionErrors holds the times of recent deletion errors
+	deletionErrors     []time.Time
+	deletionErrorsLock sync.Mutex
+	lastRateAlert      time.Time
+)
+
+func initAlert() {
+	switch ALERT_WEBHOOK_FORMAT {
+	case "slack", "json":
+	default:
+		fatal("Unknown alert webhook format: %s", ALERT_WEBHOOK_FORMAT)
+	}
+	if ALERT_WEBHOOK != "" {
+		info("Alert webhook: %s", ALERT_WEBHOOK)
+	}
+}
+
+func postAlert(text string, fields logFields) error {
+	if ALERT_WEBHOOK_FORMAT == "slack" {
+		return slack.PostWebhookCustomHTTP(ALERT_WEBHOOK, alertClient, &slack.WebhookMessage{
+			Text: ":warning: slack-blackhole: " + text,
+		})
+	}
+	data, err := json.Marshal(&alertPayload{
+		Text:      text,
+		Time:      time.Now().UTC().Format(time.RFC3339),
+		logFields: fields,
+	})
+	if err != nil {
+		return err
+	}
+	res, err := alertClient.Post(ALERT_WEBHOOK, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", res.Status)
+	}
+	return nil
+}
+
+// alert sends text to the alert webhook in background.
+func alert(text string, fields logFields) {
+	if ALERT_WEBHOOK == "" {
+		return
+	}
+	go func() {
+		err := postAlert(text, fields)
+		if err != nil {
+			logFields{Action: "alert"}.errorlog("Sending alert failed: %v", err)
+		}
+	}()
+}
+
+// recordDeletionError records a failure of a deletion API call and alerts
+// if the number of failures in ALERT_ERROR_WINDOW reaches
+// ALERT_ERROR_THRESHOLD.  The alert is sent at most once in the window.
+func recordDeletionError(fields logFields) {
+	if ALERT_ERROR_THRESHOLD <= 0 {
+		return
+	}
+	now := time.Now()
+	deletionErrorsLock.Lock()
+	defer deletionErrorsLock.Unlock()
+	deletionErrors = append(deletionErrors, now)
+	i := 0
+	for i < len(deletionErrors) && now.Sub(deletionErrors[i]) > ALERT_ERROR_WINDOW {
+		i++
+	}
+	deletionErrors = deletionErrors[i:]
+	if len(deletionErrors) < ALERT_ERROR_THRESHOLD || now.Sub(lastRateAlert) < ALERT_ERROR_WINDOW {
+		return
+	}
+	lastRateAlert = now
+	alert(fmt.Sprintf("%d deletions failed in the last %v (last: %s %s%s)",
+		len(deletionErrors), ALERT_ERROR_WINDOW, fields.Channel, fields.TS, fields.File), fields)
+}
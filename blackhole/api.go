@@ -0,0 +1,210 @@
+package blackhole
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type apiChannel struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	MessageTTL int    `json:"message_ttl"`
+	FileTTL    int    `json:"file_ttl"`
+	Configured bool   `json:"configured"`
+	Managed    bool   `json:"managed"`
+	Paused     bool   `json:"paused"`
+	Member     bool   `json:"member"`
+}
+
+type apiConfig struct {
+	DefaultMessageTTL int               `json:"default_message_ttl"`
+	DefaultFileTTL    int               `json:"default_file_ttl"`
+	DryRun            bool              `json:"dry_run"`
+	Channels          map[string]Config `json:"channels"`
+}
+
+type apiTTLRequest struct {
+	MessageTTL *int `json:"message_ttl"`
+	FileTTL    *int `json:"file_ttl"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		errorlog("Encoding API response failed: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// apiAuth requires the bearer token of --admin-api-token.  Without the token,
+// only read requests are served.
+func apiAuth(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ADMIN_API_TOKEN == "" && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeAPIError(w, http.StatusForbidden, "--admin-api-token is required to change anything")
+			return
+		}
+		if ADMIN_API_TOKEN != "" {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(ADMIN_API_TOKEN)) != 1 {
+				writeAPIError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+func apiChannelOf(id, name string) apiChannel {
+	CONFIG_LOCK.RLock()
+	_, configured := CONFIG_BY_ID[id]
+	CONFIG_LOCK.RUnlock()
+	return apiChannel{
+		ID:         id,
+		Name:       name,
+		MessageTTL: POLICY.MessageTTL(id),
+		FileTTL:    POLICY.FileTTL(id),
+		Configured: configured,
+		Managed:    POLICY.Managed(id),
+		Paused:     isPaused(id),
+		Member:     isMember(id),
+	}
+}
+
+func handleAPIQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, pendingItems())
+}
+
+func handleAPIChannels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	channels := []apiChannel{}
+	for _, ch := range getKnownChannels() {
+		channels = append(channels, apiChannelOf(ch.ID, ch.Name))
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	writeJSON(w, http.StatusOK, channels)
+}
+
+// handleAPIChannel handles /api/v1/channels/{id}.  PUT updates the TTLs of
+// the channel.
+func handleAPIChannel(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/channels/")
+	name := ""
+	for _, ch := range getKnownChannels() {
+		if ch.ID == id {
+			name = ch.Name
+		}
+	}
+	if name == "" {
+		writeAPIError(w, http.StatusNotFound, "channel not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req apiTTLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := checkMinTTLs(req.MessageTTL, req.FileTTL); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		_, err := updateChannelTTL(id, name, req.MessageTTL, req.FileTTL)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "saving the config file failed: "+err.Error())
+			return
+		}
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, apiChannelOf(id, name))
+}
+
+func handleAPIConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	cfg := apiConfig{
+		DefaultMessageTTL: DEFAULT_MESSAGE_TTL,
+		DefaultFileTTL:    DEFAULT_FILE_TTL,
+		DryRun:            DRY_RUN,
+		Channels:          make(map[string]Config),
+	}
+	CONFIG_LOCK.RLock()
+	for id, c := range CONFIG_BY_ID {
+		cfg.Channels[id] = c
+	}
+	CONFIG_LOCK.RUnlock()
+	writeJSON(w, http.StatusOK, cfg)
+}
+
+func handleAPIErrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, log.errors())
+}
+
+// handleAPIDeadLetters lists failed deletions on GET and retries them on
+// POST.
+func handleAPIDeadLetters(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, deadLetters())
+	case http.MethodPost:
+		writeJSON(w, http.StatusOK, map[string]int{"retrying": retryDeadLetters(true)})
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func handleAPIStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, statsOf())
+}
+
+func initAdminAPI() {
+	if ADMIN_API_ADDR == "" {
+		return
+	}
+	if ADMIN_API_TOKEN == "" {
+		info("BLACKHOLE_ADMIN_API_TOKEN is not set; the admin API is read only and not protected")
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/queue", apiAuth(handleAPIQueue))
+	mux.HandleFunc("/api/v1/channels", apiAuth(handleAPIChannels))
+	mux.HandleFunc("/api/v1/channels/", apiAuth(handleAPIChannel))
+	mux.HandleFunc("/api/v1/config", apiAuth(handleAPIConfig))
+	mux.HandleFunc("/api/v1/errors", apiAuth(handleAPIErrors))
+	mux.HandleFunc("/api/v1/failed", apiAuth(handleAPIDeadLetters))
+	mux.HandleFunc("/api/v1/stats", apiAuth(handleAPIStats))
+	go func() {
+		info("Listening admin API on %s", ADMIN_API_ADDR)
+		err := http.ListenAndServe(ADMIN_API_ADDR, mux)
+		fatal("ListenAndServe(%s) failed: %v", ADMIN_API_ADDR, err)
+	}()
+}
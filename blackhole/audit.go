@@ -0,0 +1,157 @@
+package blackhole
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// auditRecord is a record of a successful deletion.
+type auditRecord struct {
+	Kind      string `json:"kind"`
+	Channel   string `json:"channel,omitempty"`
+	TS        string `json:"ts,omitempty"`
+	File      string `json:"file,omitempty"`
+	User      string `json:"user,omitempty"`
+	DeletedAt string `json:"deleted_at"`
+	Snippet   string `json:"snippet,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+}
+
+type auditWriter interface {
+	writeAudit(rec *auditRecord) error
+}
+
+type auditFileWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (a *auditFileWriter) writeAudit(rec *auditRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.w.Write(append(data, '\n'))
+	return err
+}
+
+type auditWebhookWriter struct {
+	url    string
+	client *http.Client
+}
+
+func (a *auditWebhookWriter) writeAudit(rec *auditRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	res, err := a.client.Post(a.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", res.Status)
+	}
+	return nil
+}
+
+var auditWriters []auditWriter
+
+func initAudit() {
+	switch AUDIT_TEXT {
+	case "none", "snippet", "hash":
+	default:
+		fatal("Unknown audit text mode: %s", AUDIT_TEXT)
+	}
+	if AUDIT_FILE != "" {
+		f, err := os.OpenFile(AUDIT_FILE, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			fatal("OpenFile(%s) failed: %v", AUDIT_FILE, err)
+		}
+		auditWriters = append(auditWriters, &auditFileWriter{w: f})
+		info("Audit log: %s", AUDIT_FILE)
+	}
+	if AUDIT_WEBHOOK != "" {
+		auditWriters = append(auditWriters, &auditWebhookWriter{
+			url:    AUDIT_WEBHOOK,
+			client: &http.Client{Timeout: 10 * time.Second},
+		})
+		info("Audit webhook: %s", AUDIT_WEBHOOK)
+	}
+}
+
+// auditText sets Snippet or Hash of rec from text according to AUDIT_TEXT.
+func auditText(rec *auditRecord, text string) {
+	switch AUDIT_TEXT {
+	case "snippet":
+		r := []rune(text)
+		if len(r) > AUDIT_SNIPPET_LENGTH {
+			r = r[:AUDIT_SNIPPET_LENGTH]
+		}
+		rec.Snippet = string(r)
+	case "hash":
+		sum := sha256.Sum256([]byte(text))
+		rec.Hash = hex.EncodeToString(sum[:])
+	}
+}
+
+func audit(rec *auditRecord) {
+	rec.DeletedAt = time.Now().UTC().Format(time.RFC3339)
+	for _, w := range auditWriters {
+		err := w.writeAudit(rec)
+		if err != nil {
+			logFields{Action: "audit", Channel: rec.Channel, TS: rec.TS, File: rec.File}.errorlog("Writing audit record failed: %v", err)
+		}
+	}
+}
+
+func auditMessage(ch string, msg *slack.Message) {
+	rec := &auditRecord{
+		Kind:    "message",
+		Channel: ch,
+		TS:      msg.Timestamp,
+		User:    msg.User,
+	}
+	auditText(rec, msg.Text)
+	audit(rec)
+}
+
+func auditScheduledMessage(m *slack.ScheduledMessage) {
+	rec := &auditRecord{
+		Kind:    "scheduled_message",
+		Channel: m.Channel,
+		TS:      m.ID,
+	}
+	auditText(rec, m.Text)
+	audit(rec)
+}
+
+func auditFile(file *slack.File) {
+	kind := "file"
+	if isCanvas(file) {
+		kind = "canvas"
+	}
+	rec := &auditRecord{
+		Kind: kind,
+		File: file.ID,
+		User: file.User,
+	}
+	if len(file.Channels) == 1 {
+		rec.Channel = file.Channels[0]
+	}
+	auditText(rec, file.Name)
+	audit(rec)
+}
@@ -0,0 +1,142 @@
+package blackhole
+
+import (
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// ChatBackend is the transport to a chat service.  Channels, messages, files
+// and events are in the types of slack-go; other backends convert theirs
+// to them.  Timestamps of messages identify them in a channel like Slack.
+type ChatBackend interface {
+	Deleter
+
+	ListConversations() ([]slack.Channel, error)
+
+	// History returns messages in channel between oldest and latest, which
+	// are inclusive and may be "" for no bound, from newest to oldest.
+	History(channel, oldest, latest string) ([]slack.Message, error)
+
+	// ListFiles returns files created between from and to.  Zero times
+	// mean no bound.
+	ListFiles(from, to time.Time) ([]slack.File, error)
+
+	// Events returns the channel of events like *slack.MessageEvent.
+	// Connection events like *slack.ConnectedEvent are also sent so that
+	// messages during disconnections are caught up.
+	Events() <-chan interface{}
+}
+
+// BACKEND is selected by --backend.
+var BACKEND ChatBackend
+
+func initBackend() {
+	switch BACKEND_NAME {
+	case "slack":
+		initSlackRTMClient()
+	case "mattermost":
+		initMattermost()
+	default:
+		fatal("Unknown backend: %s", BACKEND_NAME)
+	}
+}
+
+// initBackendClient initializes BACKEND for API calls without receiving
+// events.
+func initBackendClient() {
+	if BACKEND_NAME == "mattermost" {
+		initMattermost()
+		return
+	}
+	initSlackClient()
+}
+
+// slackOnly returns true if the backend is Slack.  Otherwise, it logs that
+// feature is not available.
+func slackOnly(feature string, fields logFields) bool {
+	if isSlackBackend() {
+		return true
+	}
+	fields.debug("%s is not available with --backend=%s", feature, BACKEND_NAME)
+	return false
+}
+
+func isSlackBackend() bool {
+	_, ok := BACKEND.(*slackBackend)
+	return ok
+}
+
+// slackBackend is the ChatBackend with RTM.  Deletions are done by DELETER.
+type slackBackend struct{}
+
+func initSlackBackend() {
+	initDeleter()
+	BACKEND = &slackBackend{}
+}
+
+func (*slackBackend) DeleteMessage(ch, ts string) error {
+	return DELETER.DeleteMessage(ch, ts)
+}
+
+func (*slackBackend) DeleteFile(file *slack.File) error {
+	return DELETER.DeleteFile(file)
+}
+
+func (*slackBackend) ListConversations() ([]slack.Channel, error) {
+	return getAllChannels(RTM)
+}
+
+func (*slackBackend) History(ch, oldest, latest string) ([]slack.Message, error) {
+	params := &slack.GetConversationHistoryParameters{
+		ChannelID: ch,
+		Oldest:    oldest,
+		Latest:    latest,
+		Inclusive: oldest != "" || latest != "",
+	}
+	var msgs []slack.Message
+	for cont := true; cont; {
+		waitAPI("conversations.history")
+		res, err := RTM.GetConversationHistory(params)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, res.Messages...)
+		params.Cursor = res.ResponseMetaData.NextCursor
+		cont = params.Cursor != ""
+	}
+	return msgs, nil
+}
+
+func (*slackBackend) ListFiles(from, to time.Time) ([]slack.File, error) {
+	params := slack.NewGetFilesParameters()
+	if !from.IsZero() {
+		params.TimestampFrom = slack.JSONTime(from.Unix())
+	}
+	if !to.IsZero() {
+		params.TimestampTo = slack.JSONTime(to.Unix() + 1)
+	}
+	debug("NewGetFilesParameters: %v", params)
+	var allFiles []slack.File
+	for hasMore := true; hasMore; params.Page++ {
+		waitAPI("files.list")
+		files, paging, err := RTM.GetFiles(params)
+		if err != nil {
+			return nil, err
+		}
+		allFiles = append(allFiles, files...)
+		hasMore = paging.Page < paging.Pages
+	}
+	return allFiles, nil
+}
+
+func (*slackBackend) Events() <-chan interface{} {
+	events := make(chan interface{})
+	go func() {
+		for msg := range RTM.IncomingEvents {
+			events <- msg.Data
+		}
+		close(events)
+	}()
+	return events
+}
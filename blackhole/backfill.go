@@ -0,0 +1,176 @@
+package blackhole
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// parseBackfillRange parses --backfill-from and --backfill-to, which are dates like
+// "2023-01-01" in the local time zone.  Both ends are inclusive.
+func parseBackfillRange() (time.Time, time.Time, error) {
+	if BACKFILL_FROM == "" || BACKFILL_TO == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("--backfill-from and --backfill-to are required")
+	}
+	from, err := time.ParseInLocation("2006-01-02", BACKFILL_FROM, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("--backfill-from: %w", err)
+	}
+	to, err := time.ParseInLocation("2006-01-02", BACKFILL_TO, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("--backfill-to: %w", err)
+	}
+	to = to.AddDate(0, 0, 1)
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("--backfill-from is after --backfill-to")
+	}
+	return from, to, nil
+}
+
+func slackTimestamp(t time.Time) string {
+	return fmt.Sprintf("%d.000000", t.Unix())
+}
+
+// threadReplies returns the replies to msg in the range.  The range is
+// unbounded on the side given as "".
+func threadReplies(ch string, msg *slack.Message, oldest, latest string) ([]slack.Message, error) {
+	params := &slack.GetConversationRepliesParameters{
+		ChannelID: ch,
+		Timestamp: msg.Timestamp,
+		Oldest:    oldest,
+		Latest:    latest,
+	}
+	var replies []slack.Message
+	for cont := true; cont; {
+		waitAPI("conversations.replies")
+		msgs, hasMore, cursor, err := RTM.GetConversationReplies(params)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			if m.Timestamp != msg.Timestamp {
+				replies = append(replies, m)
+			}
+		}
+		params.Cursor = cursor
+		cont = hasMore && cursor != ""
+	}
+	return replies, nil
+}
+
+// backfillChannel deletes messages in ch between oldest and latest, and
+// returns the number of them.
+func backfillChannel(ch string, oldest, latest string) int {
+	msgs, err := BACKEND.History(ch, oldest, latest)
+	if err != nil {
+		fatal("History() for %s failed: %v", ch, err)
+	}
+
+	n := 0
+	for i := range msgs {
+		msg := &msgs[i]
+		if msg.ReplyCount > 0 {
+			replies, err := threadReplies(ch, msg, oldest, latest)
+			if err != nil {
+				messageLog("backfill", ch, msg.Timestamp).errorlog("GetConversationReplies(%s, %s) failed: %v", ch, msg.Timestamp, err)
+			}
+			for j := range replies {
+				if reason := exemption(ch, &replies[j]); reason != "" {
+					messageLog("keep", ch, replies[j].Timestamp).debug("Message %s(%s) is kept because %s", ch, replies[j].Timestamp, reason)
+					continue
+				}
+				deleteMessage(ch, &replies[j], 0)
+				n++
+			}
+		}
+		if reason := exemption(ch, msg); reason != "" {
+			messageLog("keep", ch, msg.Timestamp).debug("Message %s(%s) is kept because %s", ch, msg.Timestamp, reason)
+			continue
+		}
+		deleteMessage(ch, msg, 0)
+		n++
+	}
+	return n
+}
+
+// waitPending waits until all scheduled deletions are done, and returns the
+// number of those left if timeout expires first.  timeout <= 0 means no
+// timeout.
+func waitPending(timeout time.Duration) int {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		expired = time.After(timeout)
+	}
+	for {
+		n := len(pendingItems())
+		if n == 0 {
+			return 0
+		}
+		select {
+		case <-expired:
+			return n
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// backfill deletes messages between --backfill-from and --backfill-to in
+// --backfill-channels and exits.  Deletions are not spread over
+// --backlog-spread, but they wait for paused channels to be resumed and for
+// --delete-window, up to --backfill-timeout.
+func backfill() {
+	from, to, err := parseBackfillRange()
+	if err != nil {
+		fatal("%v", err)
+	}
+	if BACKFILL_CHANNELS == "" {
+		fatal("--backfill-channels is required")
+	}
+	// one-shot backfill exits as soon as the deletions are done
+	BACKLOG_SPREAD = 0
+	if isSlackBackend() {
+		initUserClient()
+	}
+	initBackendClient()
+	initTTL()
+	initExcludeChannels()
+
+	channels, err := BACKEND.ListConversations()
+	if err != nil {
+		fatal("getting the list of channels failed: %v", err)
+	}
+	var ids []string
+	for _, name := range strings.Split(BACKFILL_CHANNELS, ",") {
+		name = strings.TrimPrefix(strings.TrimSpace(name), "#")
+		if name == "" {
+			continue
+		}
+		id := ""
+		for _, ch := range channels {
+			if ch.Name == name || ch.ID == name {
+				id = ch.ID
+			}
+		}
+		if id == "" {
+			fatal("Channel %s is not found", name)
+		}
+		if !POLICY.Managed(id) {
+			fatal("Channel %s is not managed", name)
+		}
+		ids = append(ids, id)
+	}
+
+	info("Backfill messages from %v to %v in %v", from, to, ids)
+	total := 0
+	for _, id := range ids {
+		n := backfillChannel(id, slackTimestamp(from), slackTimestamp(to))
+		logFields{Action: "backfill", Channel: id}.info("%d messages in %s are to be deleted", n, id)
+		total += n
+	}
+	if n := waitPending(BACKFILL_TIMEOUT); n > 0 {
+		fatal("Backfill timed out after %v with %d deletions left", BACKFILL_TIMEOUT, n)
+	}
+	info("Backfill done: %d messages", total)
+}
@@ -0,0 +1,81 @@
+// Package blackhole is the retention engine of slack-blackhole, which
+// deletes messages and files in Slack channels after their TTLs.
+//
+// The command slack-blackhole is a thin wrapper of Main.  A program which
+// embeds the engine can replace DELETER and POLICY before calling Main, or
+// register the flags with RegisterFlags, call Init and feed messages and
+// files to the Scheduler returned by NewScheduler.
+package blackhole
+
+import (
+	"github.com/slack-go/slack"
+)
+
+// Deleter deletes messages and files.
+type Deleter interface {
+	DeleteMessage(channel, ts string) error
+	DeleteFile(file *slack.File) error
+}
+
+// PolicyResolver resolves the retention policy of channels.  TTLs are in
+// seconds and 0 means that nothing is deleted by TTL.
+type PolicyResolver interface {
+	Managed(channel string) bool
+	MessageTTL(channel string) int
+	FileTTL(channel string) int
+}
+
+// Scheduler schedules deletions of messages and files according to POLICY.
+// The deletions are done by DELETER when the TTLs expire.
+type Scheduler interface {
+	ScheduleMessage(channel string, msg *slack.Message)
+	ScheduleFile(file *slack.File)
+}
+
+var (
+	// DELETER is set to a SlackDeleter on connecting to Slack unless it
+	// is set before.
+	DELETER Deleter
+
+	POLICY PolicyResolver = ConfigPolicy{}
+)
+
+// ConfigPolicy is the PolicyResolver with the config file, the flags and
+// the topic directives.
+type ConfigPolicy struct{}
+
+func (ConfigPolicy) Managed(ch string) bool {
+	return managed(ch)
+}
+
+func (ConfigPolicy) MessageTTL(ch string) int {
+	return messageTTL(ch)
+}
+
+func (ConfigPolicy) FileTTL(ch string) int {
+	return fileTTL(ch)
+}
+
+type scheduler struct{}
+
+// NewScheduler returns the Scheduler which handles messages and files in
+// the same way as events from Slack.
+func NewScheduler() Scheduler {
+	return scheduler{}
+}
+
+func (scheduler) ScheduleMessage(ch string, msg *slack.Message) {
+	handleMessage(ch, msg)
+}
+
+func (scheduler) ScheduleFile(file *slack.File) {
+	handleFile(file)
+}
+
+// Init starts the API throttle and the deletion workers without connecting
+// to Slack.  The flags registered by RegisterFlags have to be parsed
+// before.  Main does it by itself.
+func Init() {
+	initApiThrottle()
+	initDeletionWorkers()
+}
@@ -0,0 +1,507 @@
+package blackhole
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// mockSlackClient is the SlackClient which records deletions instead of
+// calling the API.
+type mockSlackClient struct {
+	mu       sync.Mutex
+	err      error
+	messages []string
+	files    []string
+}
+
+func (c *mockSlackClient) DeleteMessage(ch, ts string) (string, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return "", "", c.err
+	}
+	c.messages = append(c.messages, ch+"/"+ts)
+	return ch, ts, nil
+}
+
+func (c *mockSlackClient) DeleteFile(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.files = append(c.files, id)
+	return nil
+}
+
+func (c *mockSlackClient) deleted() ([]string, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.messages...), append([]string{}, c.files...)
+}
+
+type mockPolicy struct {
+	managed    map[string]bool
+	messageTTL int
+	fileTTL    int
+}
+
+func (p mockPolicy) Managed(ch string) bool {
+	return p.managed[ch]
+}
+
+func (p mockPolicy) MessageTTL(ch string) int {
+	return p.messageTTL
+}
+
+func (p mockPolicy) FileTTL(ch string) int {
+	return p.fileTTL
+}
+
+func TestMain(m *testing.M) {
+	log.out = ioutil.Discard
+	DELETION_WORKERS = 1
+	initDeletionWorkers()
+	os.Exit(m.Run())
+}
+
+// useMocks replaces DELETER and POLICY with mocks.  The returned function
+// restores them.
+func useMocks(policy PolicyResolver) (*mockSlackClient, func()) {
+	client := &mockSlackClient{}
+	deleter, oldPolicy := DELETER, POLICY
+	DELETER = &SlackDeleter{Client: client}
+	POLICY = policy
+	return client, func() {
+		DELETER, POLICY = deleter, oldPolicy
+	}
+}
+
+func slackTS(t time.Time) string {
+	return fmt.Sprintf("%d.000100", t.Unix())
+}
+
+// waitFor waits until cond returns true, and fails the test on timeout.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out")
+}
+
+func pendingIn(ch string) []pendingItem {
+	var items []pendingItem
+	for _, p := range pendingItems() {
+		if p.Channel == ch {
+			items = append(items, p)
+		}
+	}
+	return items
+}
+
+func TestSchedulerDeletesExpiredMessage(t *testing.T) {
+	client, restore := useMocks(mockPolicy{managed: map[string]bool{"C1": true}, messageTTL: 60})
+	defer restore()
+	ts := slackTS(time.Now().Add(-2 * time.Minute))
+	NewScheduler().ScheduleMessage("C1", &slack.Message{Msg: slack.Msg{Timestamp: ts, Text: "hello"}})
+
+	waitFor(t, func() bool {
+		msgs, _ := client.deleted()
+		return len(msgs) == 1
+	})
+	msgs, _ := client.deleted()
+	if msgs[0] != "C1/"+ts {
+		t.Errorf("deleted %v, want [C1/%s]", msgs, ts)
+	}
+	waitFor(t, func() bool { return len(pendingIn("C1")) == 0 })
+}
+
+func TestSchedulerWaitsForTTL(t *testing.T) {
+	// the deletion stays pending after the test; use a unique channel
+	ch := fmt.Sprintf("C2-%d", time.Now().UnixNano())
+	client, restore := useMocks(mockPolicy{managed: map[string]bool{ch: true}, messageTTL: 3600})
+	defer restore()
+	now := time.Now()
+	NewScheduler().ScheduleMessage(ch, &slack.Message{Msg: slack.Msg{Timestamp: slackTS(now)}})
+
+	items := pendingIn(ch)
+	if len(items) != 1 {
+		t.Fatalf("pending items: %v, want 1 item", items)
+	}
+	want := time.Unix(now.Unix(), 100000).Add(time.Hour)
+	if d := items[0].DueAt.Sub(want); d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("DueAt: %v, want %v", items[0].DueAt, want)
+	}
+	if msgs, _ := client.deleted(); len(msgs) != 0 {
+		t.Errorf("deleted %v before the TTL", msgs)
+	}
+}
+
+func TestSchedulerSkipsUnmanagedChannel(t *testing.T) {
+	client, restore := useMocks(mockPolicy{messageTTL: 60})
+	defer restore()
+	NewScheduler().ScheduleMessage("C3", &slack.Message{Msg: slack.Msg{Timestamp: slackTS(time.Now().Add(-time.Hour))}})
+
+	if items := pendingIn("C3"); len(items) != 0 {
+		t.Errorf("pending items: %v, want none", items)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if msgs, _ := client.deleted(); len(msgs) != 0 {
+		t.Errorf("deleted %v in an unmanaged channel", msgs)
+	}
+}
+
+func TestSchedulerDryRun(t *testing.T) {
+	client, restore := useMocks(mockPolicy{managed: map[string]bool{"C4": true}, messageTTL: 60})
+	defer restore()
+	DRY_RUN = true
+	defer func() { DRY_RUN = false }()
+	NewScheduler().ScheduleMessage("C4", &slack.Message{Msg: slack.Msg{Timestamp: slackTS(time.Now().Add(-time.Hour))}})
+
+	waitFor(t, func() bool { return len(pendingIn("C4")) == 0 })
+	if msgs, _ := client.deleted(); len(msgs) != 0 {
+		t.Errorf("deleted %v in dry-run", msgs)
+	}
+}
+
+func TestSchedulerDeletesExpiredFile(t *testing.T) {
+	client, restore := useMocks(mockPolicy{managed: map[string]bool{"C5": true}, fileTTL: 60})
+	defer restore()
+	NewScheduler().ScheduleFile(&slack.File{
+		ID:        "F1",
+		Channels:  []string{"C5"},
+		Timestamp: slack.JSONTime(time.Now().Add(-time.Hour).Unix()),
+	})
+
+	waitFor(t, func() bool {
+		_, files := client.deleted()
+		return len(files) == 1
+	})
+	if _, files := client.deleted(); files[0] != "F1" {
+		t.Errorf("deleted %v, want [F1]", files)
+	}
+}
+
+func TestSchedulerDedupesSweepAndEvent(t *testing.T) {
+	ch := fmt.Sprintf("C6-%d", time.Now().UnixNano())
+	_, restore := useMocks(mockPolicy{managed: map[string]bool{ch: true}, messageTTL: 3600, fileTTL: 3600})
+	defer restore()
+	ts := slackTS(time.Now())
+	file := &slack.File{ID: "F" + ch, Channels: []string{ch}, Timestamp: slack.JSONTime(time.Now().Unix())}
+
+	// the event
+	NewScheduler().ScheduleMessage(ch, &slack.Message{Msg: slack.Msg{Timestamp: ts}})
+	NewScheduler().ScheduleFile(file)
+	// the sweep finds them again
+	msg := slack.Message{Msg: slack.Msg{Timestamp: ts}}
+	deleteMessage(ch, &msg, POLICY.MessageTTL(ch))
+	NewScheduler().ScheduleFile(file)
+
+	items := pendingIn(ch)
+	if len(items) != 2 || items[0].Kind == items[1].Kind {
+		t.Errorf("pending items: %v, want a message and a file", items)
+	}
+}
+
+func TestSchedulerDeletesOverlappingMessageOnce(t *testing.T) {
+	client, restore := useMocks(mockPolicy{managed: map[string]bool{"C7": true}, messageTTL: 1})
+	defer restore()
+	// expires in 300ms
+	posted := time.Now().Add(-700 * time.Millisecond)
+	ts := fmt.Sprintf("%d.%06d", posted.Unix(), posted.Nanosecond()/1000)
+	for i := 0; i < 3; i++ {
+		NewScheduler().ScheduleMessage("C7", &slack.Message{Msg: slack.Msg{Timestamp: ts}})
+	}
+
+	waitFor(t, func() bool { return len(pendingIn("C7")) == 0 })
+	if msgs, _ := client.deleted(); len(msgs) != 1 {
+		t.Errorf("deleted %v, want once", msgs)
+	}
+
+	// it can be scheduled again after the deletion, e.g. a retry
+	PENDING_LOCK.Lock()
+	_, ok := PENDING_INDEX[pendingKey("message", "C7", ts, "")]
+	PENDING_LOCK.Unlock()
+	if ok {
+		t.Errorf("PENDING_INDEX has the deleted message")
+	}
+}
+
+func TestSchedulerMovesDueAtEarlier(t *testing.T) {
+	ch := fmt.Sprintf("C8-%d", time.Now().UnixNano())
+	client, restore := useMocks(mockPolicy{managed: map[string]bool{ch: true}, messageTTL: 3600})
+	defer restore()
+	ts := slackTS(time.Now())
+	NewScheduler().ScheduleMessage(ch, &slack.Message{Msg: slack.Msg{Timestamp: ts}})
+
+	// a sweep finds it exceeds max_messages
+	deleteMessage(ch, &slack.Message{Msg: slack.Msg{Timestamp: ts}}, 0)
+
+	waitFor(t, func() bool {
+		msgs, _ := client.deleted()
+		return len(msgs) == 1
+	})
+	waitFor(t, func() bool { return len(pendingIn(ch)) == 0 })
+}
+
+func TestSchedulerCancelsPending(t *testing.T) {
+	client, restore := useMocks(mockPolicy{managed: map[string]bool{"C9": true}, messageTTL: 1})
+	defer restore()
+	// expires in 300ms
+	posted := time.Now().Add(-700 * time.Millisecond)
+	ts := fmt.Sprintf("%d.%06d", posted.Unix(), posted.Nanosecond()/1000)
+	NewScheduler().ScheduleMessage("C9", &slack.Message{Msg: slack.Msg{Timestamp: ts}})
+
+	if !cancelPending("message", "C9", ts, "") {
+		t.Fatalf("cancelPending() = false, want true")
+	}
+	if items := pendingIn("C9"); len(items) != 0 {
+		t.Errorf("pending items: %v, want none", items)
+	}
+	time.Sleep(time.Second)
+	if msgs, _ := client.deleted(); len(msgs) != 0 {
+		t.Errorf("deleted %v, want none", msgs)
+	}
+}
+
+func TestRetryDeadLetterWithoutAPI(t *testing.T) {
+	_, restore := useMocks(mockPolicy{managed: map[string]bool{"C10": true}, messageTTL: 60})
+	defer restore()
+	DRY_RUN = true
+	defer func() { DRY_RUN = false }()
+	d := &deadLetter{Kind: "message", Channel: "C10", TS: slackTS(time.Now().Add(-time.Hour)), Class: errorTransient}
+	DEAD_LETTERS_LOCK.Lock()
+	DEAD_LETTERS[d.key()] = d
+	DEAD_LETTERS_LOCK.Unlock()
+	defer removeDeadLetter(d)
+
+	if n := retryDeadLetters(false); n != 1 {
+		t.Fatalf("retryDeadLetters() = %d, want 1", n)
+	}
+	// the dry-run retry doesn't reach the API; it can be retried again
+	waitFor(t, func() bool {
+		DEAD_LETTERS_LOCK.Lock()
+		defer DEAD_LETTERS_LOCK.Unlock()
+		return !d.retrying
+	})
+	if n := retryDeadLetters(false); n != 1 {
+		t.Errorf("retryDeadLetters() = %d after the retry ended, want 1", n)
+	}
+	waitFor(t, func() bool { return len(pendingIn("C10")) == 0 })
+}
+
+func TestConfigPolicy(t *testing.T) {
+	CONFIG_LOCK.Lock()
+	CONFIG_BY_ID["C10"] = Config{Channel: "configured", MessageTTL: 600}
+	CONFIG_LOCK.Unlock()
+	DEFAULT_MESSAGE_TTL, DEFAULT_FILE_TTL = 60, 120
+	defer func() {
+		CONFIG_LOCK.Lock()
+		delete(CONFIG_BY_ID, "C10")
+		CONFIG_LOCK.Unlock()
+		DEFAULT_MESSAGE_TTL, DEFAULT_FILE_TTL = 0, 0
+		POLICY_MODE = ""
+	}()
+
+	p := ConfigPolicy{}
+	tests := []struct {
+		ch          string
+		mode        string
+		managed     bool
+		messageTTL  int
+		fileTTL     int
+		description string
+	}{
+		{"C10", "denylist", true, 600, 120, "configured channel"},
+		{"C11", "denylist", true, 60, 120, "default TTLs"},
+		{"C10", "allowlist", true, 600, 120, "configured channel in allowlist mode"},
+		{"C11", "allowlist", false, 60, 120, "channel not in the allowlist"},
+	}
+	for _, tt := range tests {
+		POLICY_MODE = tt.mode
+		if got := p.Managed(tt.ch); got != tt.managed {
+			t.Errorf("%s: Managed() = %v, want %v", tt.description, got, tt.managed)
+		}
+		if got := p.MessageTTL(tt.ch); got != tt.messageTTL {
+			t.Errorf("%s: MessageTTL() = %d, want %d", tt.description, got, tt.messageTTL)
+		}
+		if got := p.FileTTL(tt.ch); got != tt.fileTTL {
+			t.Errorf("%s: FileTTL() = %d, want %d", tt.description, got, tt.fileTTL)
+		}
+	}
+}
+
+func TestConfigPolicyTopicDirective(t *testing.T) {
+	CONFIG_LOCK.Lock()
+	CONFIG_BY_ID["C20"] = Config{Channel: "configured", MessageTTL: 600}
+	CONFIG_LOCK.Unlock()
+	TOPIC_DIRECTIVES = true
+	DEFAULT_MESSAGE_TTL = 60
+	defer func() {
+		CONFIG_LOCK.Lock()
+		delete(CONFIG_BY_ID, "C20")
+		CONFIG_LOCK.Unlock()
+		TOPIC_DIRECTIVES = false
+		TOPIC_DIRECTIVE_PRECEDENCE = ""
+		DEFAULT_MESSAGE_TTL = 0
+	}()
+
+	topic := &directiveSource{"[blackhole: 2h]", "UOWNER"}
+	purpose := &directiveSource{"[blackhole: 3h]", "UOWNER"}
+	setChannelText("C20", "UOWNER", topic, purpose)
+	setChannelText("C21", "UOWNER", nil, purpose)
+	setChannelText("C22", "UOWNER", &directiveSource{"[blackhole: 1m]", "UOTHER"}, nil)
+	setChannelText("C23", "UOWNER", &directiveSource{"[blackhole: 0]", "UOWNER"}, nil)
+	for _, ch := range []string{"C22", "C23"} {
+		if ttl, ok := topicTTL(ch); ok {
+			t.Errorf("Directive in %s is honored with TTL %d", ch, ttl)
+		}
+	}
+
+	p := ConfigPolicy{}
+	TOPIC_DIRECTIVE_PRECEDENCE = "config"
+	if got := p.MessageTTL("C20"); got != 600 {
+		t.Errorf("MessageTTL(C20) = %d, want 600 from the config file", got)
+	}
+	if got := p.MessageTTL("C21"); got != 3*3600 {
+		t.Errorf("MessageTTL(C21) = %d, want %d from the purpose", got, 3*3600)
+	}
+	TOPIC_DIRECTIVE_PRECEDENCE = "topic"
+	if got := p.MessageTTL("C20"); got != 2*3600 {
+		t.Errorf("MessageTTL(C20) = %d, want %d from the topic", got, 2*3600)
+	}
+}
+
+func TestConfigPolicyChannelTTLs(t *testing.T) {
+	CHANNEL_TTLS = "general=7d:files=30d, tmp-*=24h, tmp-keep=0, later=1h"
+	defer func() {
+		CONFIG_LOCK.Lock()
+		for _, id := range []string{"C30", "C31", "C32", "C33"} {
+			delete(CONFIG_BY_ID, id)
+		}
+		delete(UNBOUND_CONFIGS, "later")
+		CHANNEL_PATTERNS = nil
+		CONFIG_LOCK.Unlock()
+		CHANNEL_TTLS = ""
+	}()
+
+	channels := []slack.Channel{}
+	for id, name := range map[string]string{"C30": "general", "C31": "tmp-a", "C32": "tmp-keep"} {
+		ch := slack.Channel{}
+		ch.ID, ch.Name = id, name
+		channels = append(channels, ch)
+	}
+	loadConfig(channels)
+	handleChannelCreated("C33", "tmp-b")
+
+	p := ConfigPolicy{}
+	tests := []struct {
+		ch         string
+		messageTTL int
+		fileTTL    int
+	}{
+		{"C30", 7 * 86400, 30 * 86400},
+		{"C31", 86400, 0},
+		{"C32", 0, 0},
+		{"C33", 86400, 0},
+	}
+	for _, tt := range tests {
+		if got := p.MessageTTL(tt.ch); got != tt.messageTTL {
+			t.Errorf("MessageTTL(%s) = %d, want %d", tt.ch, got, tt.messageTTL)
+		}
+		if got := p.FileTTL(tt.ch); got != tt.fileTTL {
+			t.Errorf("FileTTL(%s) = %d, want %d", tt.ch, got, tt.fileTTL)
+		}
+	}
+	if _, ok := UNBOUND_CONFIGS["later"]; !ok {
+		t.Errorf("Config of later is not kept until the channel appears")
+	}
+	if _, err := parseChannelTTLs("general:7d"); err == nil {
+		t.Errorf("parseChannelTTLs(general:7d) succeeded, want an error")
+	}
+}
+
+func TestChannelTTLsKeepConfigFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "blackhole-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprint(f, `[{"channel": "general", "message_ttl": 3600, "file_ttl": 7200, "keep_patterns": ["#keep"], "only_bots": true}]`)
+	f.Close()
+	CONFIG_FILE, CHANNEL_TTLS = f.Name(), "general=7d"
+	defer func() {
+		CONFIG_FILE, CHANNEL_TTLS = "", ""
+	}()
+
+	cfgs := readConfigs()
+	if len(cfgs) != 1 {
+		t.Fatalf("readConfigs() returned %d configs, want 1", len(cfgs))
+	}
+	cfg := cfgs[0]
+	if cfg.MessageTTL != 7*86400 || cfg.FileTTL != 7200 {
+		t.Errorf("TTLs = %d, %d, want %d from --channel-ttls and 7200 from the file", cfg.MessageTTL, cfg.FileTTL, 7*86400)
+	}
+	if !cfg.OnlyBots || cfg.keepPattern("#keep this") == "" {
+		t.Errorf("only_bots and keep_patterns in the file are lost: %+v", cfg)
+	}
+	saved, ok := persistedConfig(cfg)
+	if !ok || saved.MessageTTL != 3600 || len(saved.KeepPatterns) != 1 {
+		t.Errorf("persistedConfig() = %+v, %v, want the config in the file", saved, ok)
+	}
+}
+
+func TestSummaryPostIsExempted(t *testing.T) {
+	SELF_USER_ID = "USELF"
+	defer func() { SELF_USER_ID = "" }()
+	cfg := Config{PostSummary: &SummaryConfig{Every: "1d"}}
+	msg := &slack.Message{}
+	msg.User, msg.Text = "USELF", ":hole: 1 messages older than 7 days were removed"
+	if exemptionBy(cfg, "C40", msg) == "" {
+		t.Errorf("Summary post is not exempted")
+	}
+	msg.User = "UOTHER"
+	if reason := exemptionBy(cfg, "C40", msg); reason != "" {
+		t.Errorf("Message of another user is exempted: %s", reason)
+	}
+}
+
+func TestUnarchiveKeepsAdminPause(t *testing.T) {
+	handleChannelArchive("C50")
+	handleChannelUnarchive("C50")
+	if isPaused("C50") {
+		t.Errorf("Channel paused by archiving is not resumed on unarchiving")
+	}
+
+	handleChannelArchive("C51")
+	pauseChannel("C51")
+	handleChannelUnarchive("C51")
+	if !isPaused("C51") {
+		t.Errorf("Channel paused by the admin is resumed on unarchiving")
+	}
+	resumeChannel("C51")
+}
+
+func TestAdminTTLRejectsNegative(t *testing.T) {
+	for _, args := range [][]string{{"<#C60|tmp>", "-1h"}, {"<#C60|tmp>", "1h", "-1d"}} {
+		if _, err := adminTTL(args); err == nil {
+			t.Errorf("adminTTL(%v) succeeded", args)
+		}
+	}
+	CONFIG_LOCK.RLock()
+	_, ok := CONFIG_BY_ID["C60"]
+	CONFIG_LOCK.RUnlock()
+	if ok {
+		t.Errorf("Negative TTL is set")
+	}
+}
@@ -0,0 +1,50 @@
+package blackhole
+
+import (
+	"sort"
+
+	"github.com/slack-go/slack"
+)
+
+// enforceFileBudget deletes the oldest files until the total size of files
+// falls under MAX_FILE_BYTES and the total size of files in each channel
+// falls under max_file_bytes of the channel.  Files shared to multiple
+// channels are counted but never deleted.
+func enforceFileBudget(files []slack.File, sw *sweep) {
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Timestamp.Time().Before(files[j].Timestamp.Time())
+	})
+
+	var total int64
+	usage := make(map[string]int64)
+	for _, f := range files {
+		total += int64(f.Size)
+		for _, ch := range f.Channels {
+			usage[ch] += int64(f.Size)
+		}
+	}
+	debug("Total size of files: %d bytes", total)
+
+	for i := 0; i < len(files); i++ {
+		f := &files[i]
+		if len(f.Channels) != 1 || isCanvas(f) {
+			continue
+		}
+		ch := f.Channels[0]
+		if !POLICY.Managed(ch) {
+			continue
+		}
+		max := channelConfig(ch).MaxFileBytes
+		overTotal := MAX_FILE_BYTES > 0 && total > MAX_FILE_BYTES
+		overChannel := max > 0 && usage[ch] > max
+		if !overTotal && !overChannel {
+			continue
+		}
+		if sw.admitFile(f, true) {
+			fileLog("max_file_bytes", f.ID).info("File %s (%d bytes) exceeds the file size budget (total %d bytes, channel %s %d bytes)", f.ID, f.Size, total, ch, usage[ch])
+			deleteFile(ch, f, 0)
+		}
+		total -= int64(f.Size)
+		usage[ch] -= int64(f.Size)
+	}
+}
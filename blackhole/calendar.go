@@ -0,0 +1,109 @@
+package blackhole
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+var retainUntilRe = regexp.MustCompile(`^end_of_(day|week|month|quarter|year)(?:\+(\d+))?$`)
+
+// calendarRule is a parsed retain_until like "end_of_month+1", which is the
+// end of the calendar month following the one.
+type calendarRule struct {
+	unit  string
+	extra int
+	loc   *time.Location
+}
+
+func parseCalendarRule(s, tz string) (*calendarRule, error) {
+	m := retainUntilRe.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("must be like end_of_month or end_of_quarter+1: %s", s)
+	}
+	r := &calendarRule{unit: m[1], loc: time.UTC}
+	if m[2] != "" {
+		n, err := strconv.Atoi(m[2])
+		if err != nil {
+			return nil, err
+		}
+		r.extra = n
+	}
+	if tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, err
+		}
+		r.loc = loc
+	}
+	return r, nil
+}
+
+// deadline returns the end of the period containing t, which is the start of
+// the next period, plus the extra periods.  Weeks start on Monday.
+func (r *calendarRule) deadline(t time.Time) time.Time {
+	t = t.In(r.loc)
+	y, m, d := t.Date()
+	switch r.unit {
+	case "day":
+		return time.Date(y, m, d+1+r.extra, 0, 0, 0, 0, r.loc)
+	case "week":
+		sinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-sinceMonday+7*(1+r.extra), 0, 0, 0, 0, r.loc)
+	case "month":
+		return time.Date(y, m+time.Month(1+r.extra), 1, 0, 0, 0, 0, r.loc)
+	case "quarter":
+		first := (m-1)/3*3 + 1
+		return time.Date(y, first+time.Month(3*(1+r.extra)), 1, 0, 0, 0, 0, r.loc)
+	default:
+		return time.Date(y+1+r.extra, 1, 1, 0, 0, 0, 0, r.loc)
+	}
+}
+
+// calendarTTL returns ttl, or 1 second if ttl is 0 but cfg has
+// retain_until so that messages and files are deleted at the end of the
+// period of posting.
+func (cfg *Config) calendarTTL(ttl int) int {
+	if ttl == 0 && cfg.retainUntil != nil {
+		return 1
+	}
+	return ttl
+}
+
+// retainUntilDeadline returns tbd by TTL postponed to the end of the period
+// of retain_until of cfg.
+func (cfg *Config) retainUntilDeadline(tbd time.Time) time.Time {
+	if cfg.retainUntil == nil {
+		return tbd
+	}
+	return cfg.retainUntil.deadline(tbd)
+}
+
+// messageDeadline returns the time when msg in ch is to be deleted by ttl.
+func messageDeadline(ch string, msg *slack.Message, ttl int) (time.Time, error) {
+	cfg := channelConfig(ch)
+	return cfg.messageDeadline(ch, msg, ttl)
+}
+
+// messageDeadline is messageDeadline with cfg as the config of ch.  ttl 0
+// means now as toBeDeleted.
+func (cfg *Config) messageDeadline(ch string, msg *slack.Message, ttl int) (time.Time, error) {
+	tbd, err := toBeDeleted(baseTimestampBy(*cfg, ch, msg), ttl)
+	if err != nil || ttl == 0 {
+		return tbd, err
+	}
+	return cfg.retainUntilDeadline(tbd), nil
+}
+
+// fileDeadline returns the time when file in ch is to be deleted by ttl.
+func fileDeadline(ch string, file *slack.File, ttl int) time.Time {
+	tbd := file.Timestamp.Time().Add(time.Duration(ttl) * time.Second)
+	if ttl == 0 {
+		return tbd
+	}
+	cfg := channelConfig(ch)
+	return cfg.retainUntilDeadline(tbd)
+}
@@ -0,0 +1,83 @@
+package blackhole
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// isCanvas returns true if file is a canvas.  Canvases are listed as files
+// of type "quip".
+func isCanvas(file *slack.File) bool {
+	return file.Filetype == "quip" || file.Filetype == "canvas"
+}
+
+// handleCanvas schedules the deletion of the canvas in ch according to
+// canvas_ttl.  Canvases are never deleted as files.
+func handleCanvas(ch string, file *slack.File) {
+	if !CANVASES_BOOKMARKS {
+		fileLog("skip", file.ID).debug("Canvas %s will not be deleted because --canvases-bookmarks is not set", file.ID)
+		return
+	}
+	ttl := channelConfig(ch).CanvasTTL
+	if ttl > 0 {
+		deleteFile(ch, file, ttl)
+	}
+}
+
+type bookmark struct {
+	ID          string `json:"id"`
+	ChannelID   string `json:"channel_id"`
+	Title       string `json:"title"`
+	Link        string `json:"link"`
+	DateCreated int64  `json:"date_created"`
+	DateUpdated int64  `json:"date_updated"`
+}
+
+func listBookmarks(ch string) ([]bookmark, error) {
+	var res struct {
+		Bookmarks []bookmark `json:"bookmarks"`
+	}
+	err := callAPI(SLACK_API_TOKEN, "bookmarks.list", url.Values{"channel_id": {ch}}, &res)
+	return res.Bookmarks, err
+}
+
+func removeBookmark(ch, id string) error {
+	return callAPI(SLACK_API_TOKEN, "bookmarks.remove", url.Values{"channel_id": {ch}, "bookmark_id": {id}}, nil)
+}
+
+// inspectBookmarks removes bookmarks in ch which have not been updated for
+// bookmark_ttl.
+func inspectBookmarks(ch string, sw *sweep) {
+	ttl := channelConfig(ch).BookmarkTTL
+	if !CANVASES_BOOKMARKS || ttl == 0 || sw.estimate {
+		return
+	}
+	waitAPI("bookmarks.list")
+	bookmarks, err := listBookmarks(ch)
+	if err != nil {
+		logFields{Action: "bookmark", Channel: ch}.errorlog("bookmarks.list(%s) failed: %v", ch, err)
+		return
+	}
+	for _, b := range bookmarks {
+		updated := b.DateUpdated
+		if updated == 0 {
+			updated = b.DateCreated
+		}
+		tbd := time.Unix(updated, 0).Add(time.Duration(ttl) * time.Second)
+		if tbd.After(time.Now()) {
+			continue
+		}
+		fields := logFields{Action: "bookmark", Channel: ch, File: b.ID}
+		fields.info("Remove bookmark %s in %s (title='%s') updated %v", b.ID, ch, b.Title, time.Unix(updated, 0))
+		if DRY_RUN {
+			continue
+		}
+		waitAPI("bookmarks.remove")
+		if err := removeBookmark(ch, b.ID); err != nil {
+			fields.errorlog("bookmarks.remove(%s, %s) failed: %v", ch, b.ID, err)
+			recordDeletionError(fields)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package blackhole
+
+import (
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// disconnectedAt is the time of the last event before the RTM connection
+// dropped.  It is zero while connected and is used only in the event loop.
+var disconnectedAt time.Time
+
+// handleConnectionEvent handles events about the RTM connection and returns
+// true if ev is one of them.  slack-go reconnects with backoff by itself;
+// on reconnection, messages and files posted while disconnected are caught
+// up instead of waiting for the next sweep.
+func handleConnectionEvent(ev interface{}) bool {
+	switch ev := ev.(type) {
+	case *slack.ConnectingEvent:
+		info("Connecting to Slack (attempt %d)", ev.Attempt)
+	case *slack.ConnectionErrorEvent:
+		errorlog("Connecting to Slack failed (attempt %d); retrying in %v: %v", ev.Attempt, ev.Backoff, ev.ErrorObj)
+	case *slack.InvalidAuthEvent:
+		fatal("Connecting to Slack failed: invalid_auth")
+	case *slack.DisconnectedEvent:
+		if ev.Intentional {
+			return true
+		}
+		if disconnectedAt.IsZero() {
+			disconnectedAt = lastEventTime()
+		}
+		errorlog("Disconnected from Slack: %v", ev.Cause)
+	case *slack.ConnectedEvent:
+		info("Connected to Slack (connection %d)", ev.ConnectionCount)
+		if disconnectedAt.IsZero() {
+			return true
+		}
+		from := disconnectedAt.Add(-CATCH_UP_MARGIN)
+		disconnectedAt = time.Time{}
+		if CATCH_UP {
+			go catchUp(from, time.Now())
+		}
+	case *slack.IncomingEventError:
+		errorlog("Receiving an event failed: %v", ev.ErrorObj)
+	case *slack.RTMError:
+		errorlog("RTM error: %v", ev)
+	default:
+		return false
+	}
+	return true
+}
+
+// catchUp handles messages and files posted between from and to, during
+// which the connection was down.
+func catchUp(from, to time.Time) {
+	info("Catching up messages and files from %v to %v", from, to)
+	channels, err := BACKEND.ListConversations()
+	if err != nil {
+		errorlog("getting the list of channels failed: %v", err)
+		return
+	}
+	oldest, latest := slackTimestamp(from), slackTimestamp(to.Add(time.Second))
+	n := 0
+	for _, ch := range channels {
+		if !POLICY.Managed(ch.ID) || POLICY.MessageTTL(ch.ID) == 0 {
+			continue
+		}
+		// bots can't read channels they are not a member of
+		if SELF_IS_BOT && !ch.IsMember {
+			continue
+		}
+		n += catchUpChannel(ch.ID, oldest, latest)
+	}
+	n += catchUpFiles(from, to)
+	info("Caught up %d messages and files", n)
+}
+
+// catchUpChannel handles messages and thread replies in ch between oldest
+// and latest, and returns the number of them.
+func catchUpChannel(ch string, oldest, latest string) int {
+	fields := logFields{Action: "catch_up", Channel: ch}
+	msgs, err := BACKEND.History(ch, oldest, latest)
+	if err != nil {
+		fields.errorlog("History() for %s failed: %v", ch, err)
+		return 0
+	}
+
+	n := 0
+	for i := range msgs {
+		msg := &msgs[i]
+		if msg.ReplyCount > 0 {
+			replies, err := threadReplies(ch, msg, oldest, latest)
+			if err != nil {
+				fields.errorlog("GetConversationReplies(%s, %s) failed: %v", ch, msg.Timestamp, err)
+			}
+			for j := range replies {
+				handleMessage(ch, &replies[j])
+				n++
+			}
+		}
+		handleMessage(ch, msg)
+		n++
+	}
+	return n
+}
+
+// catchUpFiles handles files created between from and to, and returns the
+// number of them.
+func catchUpFiles(from, to time.Time) int {
+	files, err := BACKEND.ListFiles(from, to)
+	if err != nil {
+		logFields{Action: "catch_up"}.errorlog("ListFiles() failed: %v", err)
+		return 0
+	}
+	for i := range files {
+		handleFile(&files[i])
+	}
+	return len(files)
+}
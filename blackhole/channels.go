@@ -0,0 +1,105 @@
+package blackhole
+
+import (
+	"github.com/slack-go/slack"
+)
+
+// UNBOUND_CONFIGS has configs whose channels are not found by name, keyed by
+// the name.  A config is bound to the channel when the channel is created
+// or renamed to the name.  It is protected by CONFIG_LOCK.
+var UNBOUND_CONFIGS = make(map[string]Config)
+
+// bindConfig binds the config for name, or of the first pattern of
+// --channel-ttls matching name, if any, to channel id.
+func bindConfig(id, name string) {
+	CONFIG_LOCK.Lock()
+	defer CONFIG_LOCK.Unlock()
+	if _, ok := CONFIG_BY_ID[id]; ok {
+		return
+	}
+	cfg, ok := UNBOUND_CONFIGS[name]
+	if ok {
+		delete(UNBOUND_CONFIGS, name)
+	} else if cfg, ok = patternConfig(name); !ok {
+		return
+	}
+	CONFIG_BY_ID[id] = cfg
+	logFields{Action: "config", Channel: id}.info("CONFIG_BY_ID[%s]: %v (channel %s appeared)", id, cfg, name)
+}
+
+func handleChannelCreated(id, name string) {
+	logFields{Action: "event", Channel: id}.info("Channel created: %s(%s)", name, id)
+	bindConfig(id, name)
+}
+
+// handleChannelRename keeps the config bound to the renamed channel and
+// updates its name so that it is saved with the new name.
+func handleChannelRename(id, name string) {
+	fields := logFields{Action: "event", Channel: id}
+	fields.info("Channel renamed: %s(%s)", name, id)
+	CONFIG_LOCK.Lock()
+	cfg, ok := CONFIG_BY_ID[id]
+	if ok {
+		cfg.Channel = name
+		if cfg.fileConfig != nil {
+			file := *cfg.fileConfig
+			file.Channel = name
+			cfg.fileConfig = &file
+		}
+		CONFIG_BY_ID[id] = cfg
+	}
+	CONFIG_LOCK.Unlock()
+	if !ok {
+		bindConfig(id, name)
+		return
+	}
+	fields.info("CONFIG_BY_ID[%s]: %v (channel renamed)", id, cfg)
+	if ADMIN_PERSIST_CONFIG {
+		if err := saveConfig(); err != nil {
+			fields.errorlog("saveConfig() failed: %v", err)
+		}
+	}
+}
+
+// handleChannelArchive pauses deletions in the archived channel since
+// messages in archived channels cannot be deleted.
+func handleChannelArchive(id string) {
+	logFields{Action: "event", Channel: id}.info("Channel archived: %s", id)
+	pauseChannelBy(id, pauseByArchive)
+}
+
+// handleChannelUnarchive resumes deletions in the unarchived channel unless
+// they were paused by the admin.
+func handleChannelUnarchive(id string) {
+	fields := logFields{Action: "event", Channel: id}
+	fields.info("Channel unarchived: %s", id)
+	if !resumeChannelBy(id, pauseByArchive) && isPaused(id) {
+		fields.info("Channel %s stays paused since it is paused by the admin", id)
+	}
+}
+
+// handleChannelEvent handles events on channels and returns true if ev is
+// one of them.
+func handleChannelEvent(ev interface{}) bool {
+	switch ev := ev.(type) {
+	case *slack.ChannelCreatedEvent:
+		handleChannelCreated(ev.Channel.ID, ev.Channel.Name)
+	case *slack.GroupCreatedEvent:
+		handleChannelCreated(ev.Channel.ID, ev.Channel.Name)
+	case *slack.ChannelRenameEvent:
+		handleChannelRename(ev.Channel.ID, ev.Channel.Name)
+	case *slack.GroupRenameEvent:
+		handleChannelRename(ev.Group.ID, ev.Group.Name)
+	case *slack.ChannelArchiveEvent:
+		handleChannelArchive(ev.Channel)
+	case *slack.GroupArchiveEvent:
+		handleChannelArchive(ev.Channel)
+	case *slack.ChannelUnarchiveEvent:
+		handleChannelUnarchive(ev.Channel)
+	case *slack.GroupUnarchiveEvent:
+		handleChannelUnarchive(ev.Channel)
+	default:
+		return false
+	}
+	return true
+}
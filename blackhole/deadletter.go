@@ -0,0 +1,219 @@
+package blackhole
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// deadLetter is a deletion which was given up.  It is retried on the next
+// sweep unless it failed with a permanent error, or by the retry-failed
+// admin command.
+type deadLetter struct {
+	Kind     string    `json:"kind"`
+	Channel  string    `json:"channel"`
+	TS       string    `json:"ts,omitempty"`
+	ThreadTS string    `json:"thread_ts,omitempty"`
+	File     string    `json:"file,omitempty"`
+	Error    string    `json:"error"`
+	Class    string    `json:"class,omitempty"`
+	FailedAt time.Time `json:"failed_at"`
+	Attempts int       `json:"attempts"`
+
+	retrying bool
+}
+
+func (d *deadLetter) key() string {
+	if d.File != "" {
+		return d.Kind + "/" + d.File
+	}
+	return "message/" + d.Channel + "/" + d.TS
+}
+
+var (
+	DEAD_LETTERS      = make(map[string]*deadLetter)
+	DEAD_LETTERS_LOCK sync.Mutex
+)
+
+func initDeadLetters() {
+	if DEAD_LETTER_FILE == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(DEAD_LETTER_FILE)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		fatal("ReadFile(%s) failed: %v", DEAD_LETTER_FILE, err)
+	}
+	var letters []*deadLetter
+	err = json.Unmarshal(data, &letters)
+	if err != nil {
+		fatal("Unmarshal(%s) failed: %v", DEAD_LETTER_FILE, err)
+	}
+	for _, d := range letters {
+		DEAD_LETTERS[d.key()] = d
+	}
+	info("%d failed deletions are loaded from %s", len(letters), DEAD_LETTER_FILE)
+}
+
+// sortedDeadLetters returns copies of the dead letters sorted by failed
+// time.  DEAD_LETTERS_LOCK must be held.
+func sortedDeadLetters() []deadLetter {
+	letters := make([]deadLetter, 0, len(DEAD_LETTERS))
+	for _, d := range DEAD_LETTERS {
+		letters = append(letters, *d)
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i].FailedAt.Before(letters[j].FailedAt) })
+	return letters
+}
+
+// deadLetters is sortedDeadLetters which takes DEAD_LETTERS_LOCK.
+func deadLetters() []deadLetter {
+	DEAD_LETTERS_LOCK.Lock()
+	defer DEAD_LETTERS_LOCK.Unlock()
+	return sortedDeadLetters()
+}
+
+// saveDeadLetters writes the dead letters to DEAD_LETTER_FILE.
+// DEAD_LETTERS_LOCK must be held.
+func saveDeadLetters() {
+	if DEAD_LETTER_FILE == "" {
+		return
+	}
+	data, err := json.MarshalIndent(sortedDeadLetters(), "", "\t")
+	if err != nil {
+		errorlog("MarshalIndent dead letters failed: %v", err)
+		return
+	}
+	tmp := DEAD_LETTER_FILE + ".tmp"
+	err = ioutil.WriteFile(tmp, append(data, '\n'), 0600)
+	if err == nil {
+		err = os.Rename(tmp, DEAD_LETTER_FILE)
+	}
+	if err != nil {
+		errorlog("Saving dead letters to %s failed: %v", DEAD_LETTER_FILE, err)
+	}
+}
+
+// addDeadLetter records a deletion which was given up.
+func addDeadLetter(d *deadLetter, err error) {
+	DEAD_LETTERS_LOCK.Lock()
+	defer DEAD_LETTERS_LOCK.Unlock()
+	if old, ok := DEAD_LETTERS[d.key()]; ok {
+		d.Attempts = old.Attempts
+	}
+	d.Attempts++
+	d.FailedAt = time.Now().UTC()
+	if err != nil {
+		d.Error = err.Error()
+		d.Class = errorClass(err)
+	}
+	DEAD_LETTERS[d.key()] = d
+	saveDeadLetters()
+}
+
+// removeDeadLetter removes the dead letter of a deletion which has succeeded.
+func removeDeadLetter(d *deadLetter) {
+	DEAD_LETTERS_LOCK.Lock()
+	defer DEAD_LETTERS_LOCK.Unlock()
+	if _, ok := DEAD_LETTERS[d.key()]; !ok {
+		return
+	}
+	delete(DEAD_LETTERS, d.key())
+	saveDeadLetters()
+}
+
+// retryDeadLetters schedules the dead letters to be deleted immediately.
+// Those failed with permanent errors are retried only if permanent is true.
+// Those in channels no longer managed or paused are left as they are.  It
+// returns the number of scheduled deletions.
+//
+// A dead letter is not retried again while its retry is in progress.  The
+// retry ends with addDeadLetter or removeDeadLetter if it reaches the API;
+// endRetry covers the other cases.
+func retryDeadLetters(permanent bool) int {
+	DEAD_LETTERS_LOCK.Lock()
+	var letters []*deadLetter
+	for _, d := range DEAD_LETTERS {
+		if d.retrying || !permanent && d.Class == errorPermanent {
+			continue
+		}
+		if !POLICY.Managed(d.Channel) || isPaused(d.Channel) {
+			logFields{Action: "retry", Channel: d.Channel, TS: d.TS, File: d.File}.debug("Failed deletion of %s is not retried since the channel is not managed or paused", d.key())
+			continue
+		}
+		d.retrying = true
+		letters = append(letters, d)
+	}
+	DEAD_LETTERS_LOCK.Unlock()
+
+	for _, d := range letters {
+		logFields{Action: "retry", Channel: d.Channel, TS: d.TS, File: d.File}.info("Retry failed deletion of %s (attempts: %d)", d.key(), d.Attempts)
+		if d.Kind == "canvas" {
+			deleteFile(d.Channel, &slack.File{ID: d.File, Filetype: "canvas"}, 0)
+		} else if d.Kind == "file" {
+			deleteFile(d.Channel, &slack.File{ID: d.File}, 0)
+		} else {
+			deleteMessage(d.Channel, &slack.Message{Msg: slack.Msg{
+				Timestamp:       d.TS,
+				ThreadTimestamp: d.ThreadTS,
+			}}, 0)
+		}
+		endRetry(d)
+	}
+	return len(letters)
+}
+
+// endRetry clears retrying of d when its scheduled deletion ends, e.g. the
+// message is protected, the deletion is canceled or DRY_RUN is set.  The
+// deletion may have been merged into one already pending, or not scheduled
+// at all.
+func endRetry(d *deadLetter) {
+	kind := "file"
+	if d.Kind == "message" {
+		kind = "message"
+	}
+	PENDING_LOCK.Lock()
+	p := PENDING_INDEX[pendingKey(kind, d.Channel, d.TS, d.File)]
+	PENDING_LOCK.Unlock()
+	clear := func() {
+		DEAD_LETTERS_LOCK.Lock()
+		d.retrying = false
+		DEAD_LETTERS_LOCK.Unlock()
+	}
+	if p == nil {
+		clear()
+		return
+	}
+	go func() {
+		<-p.ended
+		clear()
+	}()
+}
+
+func messageDeadLetter(ch string, msg *slack.Message) *deadLetter {
+	return &deadLetter{Kind: "message", Channel: ch, TS: msg.Timestamp, ThreadTS: msg.ThreadTimestamp}
+}
+
+func fileDeadLetter(ch string, file *slack.File) *deadLetter {
+	kind := "file"
+	if isCanvas(file) {
+		kind = "canvas"
+	}
+	return &deadLetter{Kind: kind, Channel: ch, File: file.ID}
+}
+
+func adminRetryFailed(args []string) (string, error) {
+	if len(args) != 0 {
+		return "", fmt.Errorf("wrong number of arguments")
+	}
+	n := retryDeadLetters(true)
+	return fmt.Sprintf("Retrying %d failed deletions", n), nil
+}
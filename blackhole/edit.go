@@ -0,0 +1,101 @@
+package blackhole
+
+import (
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// baseTimestamp returns the timestamp from which the TTL of msg counts.
+func baseTimestamp(ch string, msg *slack.Message) string {
+	return baseTimestampBy(channelConfig(ch), ch, msg)
+}
+
+// baseTimestampBy is baseTimestamp with cfg as the config of ch.
+func baseTimestampBy(cfg Config, ch string, msg *slack.Message) string {
+	ts := msg.Timestamp
+	if cfg.TTLFromEdit && msg.Edited != nil && msg.Edited.Timestamp != "" {
+		ts = msg.Edited.Timestamp
+	}
+	if cfg.TTLAfterInactivity {
+		if last := lastActivity(ch); newerTimestamp(last, ts) {
+			ts = last
+		}
+	}
+	return ts
+}
+
+// recheckMessage re-checks the current state of msg, which may be edited
+// after it was scheduled, just before deletion.  It returns true if msg is
+// to be kept, or the new time to be deleted if ttl_from_edit or
+// ttl_after_inactivity postpones it.
+func recheckMessage(ch string, msg *slack.Message, ttl int) (time.Time, bool) {
+	if user := protectedBy(ch, msg.Timestamp); user != "" {
+		messageLog("keep", ch, msg.Timestamp).info("Message %s(%s) is kept because it is protected by %s", ch, msg.Timestamp, user)
+		return time.Time{}, true
+	}
+	cfg := channelConfig(ch)
+	keepSaved := cfg.KeepSaved && isSlackBackend()
+	if len(cfg.keepRegexps) == 0 && !cfg.TTLFromEdit && !cfg.TTLAfterInactivity && !keepSaved {
+		return time.Time{}, false
+	}
+	cur, err := fetchMessage(ch, msg)
+	if err != nil {
+		// the message may be kept; the next sweep schedules it again
+		messageLog("recheck", ch, msg.Timestamp).errorlog("fetchMessage(%s, %s) failed; skip deleting it: %v", ch, msg.Timestamp, err)
+		return time.Time{}, true
+	}
+	if cur == nil {
+		return time.Time{}, false
+	}
+	if p := keepPattern(ch, cur.Text); p != "" {
+		messageLog("keep", ch, msg.Timestamp).info("Message %s(%s) is kept because it matches %q", ch, msg.Timestamp, p)
+		return time.Time{}, true
+	}
+	if keepSaved {
+		saved, err := savedMessage(ch, cur)
+		if err != nil {
+			messageLog("recheck", ch, msg.Timestamp).errorlog("Listing saved items failed; skip deleting message %s(%s): %v", ch, msg.Timestamp, err)
+			return time.Time{}, true
+		}
+		if saved {
+			messageLog("keep", ch, msg.Timestamp).info("Message %s(%s) is kept because it is saved or has a reminder", ch, msg.Timestamp)
+			return time.Time{}, true
+		}
+	}
+	tbd, err := messageDeadline(ch, cur, ttl)
+	if err != nil {
+		messageLog("recheck", ch, msg.Timestamp).errorlog("toBeDeleted() for message %s(%s) failed: %v", ch, msg.Timestamp, err)
+		return time.Time{}, false
+	}
+	return tbd, false
+}
+
+// handleMessageChanged handles an edit of a message.  The deletion of a
+// message which was kept by keep_patterns is scheduled if the new text no
+// longer matches.  Otherwise, the deletion is already scheduled and the
+// scheduled deletion re-checks keep_patterns and ttl_from_edit.
+func handleMessageChanged(ch string, msg *slack.Message) {
+	if msg.SubMessage == nil {
+		return
+	}
+	cur := &slack.Message{Msg: *msg.SubMessage}
+	ts := cur.Timestamp
+	if !POLICY.Managed(ch) {
+		messageLog("edit", ch, ts).debug("Channel %s is not managed", ch)
+		return
+	}
+	if reason := exemption(ch, cur); reason != "" {
+		messageLog("keep", ch, ts).info("Edited message %s(%s) will be kept because %s", ch, ts, reason)
+		return
+	}
+	if msg.PreviousMessage == nil || keepPattern(ch, msg.PreviousMessage.Text) == "" {
+		messageLog("edit", ch, ts).debug("Message %s(%s) is edited", ch, ts)
+		return
+	}
+	ttl := POLICY.MessageTTL(ch)
+	if ttl > 0 {
+		messageLog("edit", ch, ts).info("Edited message %s(%s) no longer matches keep_patterns", ch, ts)
+		deleteMessage(ch, cur, ttl)
+	}
+}
@@ -0,0 +1,160 @@
+package blackhole
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// CHANNEL_PATTERNS has the configs of --channel-ttls whose channels are glob
+// patterns like "tmp-*", in the order given.  A channel without its own
+// config gets the config of the first matching pattern.  It is protected by
+// CONFIG_LOCK.
+var CHANNEL_PATTERNS []Config
+
+// channelTTL is an entry of --channel-ttls.  nil TTLs are not given.
+type channelTTL struct {
+	channel    string
+	messageTTL *int
+	fileTTL    *int
+}
+
+// apply returns cfg with the TTLs of t.  Other fields of cfg are kept.
+func (t channelTTL) apply(cfg Config) (Config, error) {
+	cfg.Channel = t.channel
+	if t.messageTTL != nil {
+		cfg.MessageTTL = *t.messageTTL
+	}
+	if t.fileTTL != nil {
+		cfg.FileTTL = *t.fileTTL
+	}
+	cfg.fromEnv = true
+	if err := cfg.compile(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// parseChannelTTLs parses --channel-ttls like "general=7d:files=30d,tmp-*=24h".
+// An entry is a channel name or a glob pattern, "=", the message TTL, and
+// optionally ":files=" and the file TTL.  TTLs are seconds or durations like
+// "24h" and "7d".
+func parseChannelTTLs(s string) ([]channelTTL, error) {
+	entries := []channelTTL{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("entry must be like general=7d:files=30d: %s", entry)
+		}
+		e := channelTTL{channel: kv[0]}
+		if _, err := path.Match(e.channel, ""); err != nil {
+			return nil, fmt.Errorf("pattern %s: %w", e.channel, err)
+		}
+		ttls := strings.Split(kv[1], ":")
+		if ttls[0] != "" {
+			ttl, err := parseTTL(ttls[0])
+			if err != nil {
+				return nil, fmt.Errorf("message TTL of %s: %w", e.channel, err)
+			}
+			e.messageTTL = &ttl
+		}
+		for _, t := range ttls[1:] {
+			if !strings.HasPrefix(t, "files=") {
+				return nil, fmt.Errorf("%s of %s must be like files=30d", t, e.channel)
+			}
+			ttl, err := parseTTL(strings.TrimPrefix(t, "files="))
+			if err != nil {
+				return nil, fmt.Errorf("file TTL of %s: %w", e.channel, err)
+			}
+			e.fileTTL = &ttl
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func parseTTL(s string) (int, error) {
+	d, err := parseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative: %s", s)
+	}
+	return int(d / time.Second), nil
+}
+
+func isChannelPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// readConfigs returns the configs of CONFIG_FILE and --channel-ttls.  The
+// TTLs of the latter override those of the former for the same channel,
+// and the other fields in CONFIG_FILE are kept.
+func readConfigs() []Config {
+	cfgs := []Config{}
+	if CONFIG_FILE != "" {
+		cfgs = readConfigFile(CONFIG_FILE)
+	}
+	if CHANNEL_TTLS == "" {
+		return cfgs
+	}
+	entries, err := parseChannelTTLs(CHANNEL_TTLS)
+	if err != nil {
+		fatal("Invalid --channel-ttls: %v", err)
+	}
+	for _, e := range entries {
+		overridden := false
+		for i := range cfgs {
+			if cfgs[i].Channel != e.channel {
+				continue
+			}
+			info("TTLs of %s in %s are overridden by --channel-ttls", e.channel, CONFIG_FILE)
+			file := cfgs[i]
+			if cfgs[i], err = e.apply(file); err != nil {
+				fatal("Invalid --channel-ttls: %v", err)
+			}
+			cfgs[i].fileConfig = &file
+			overridden = true
+		}
+		if overridden {
+			continue
+		}
+		cfg, err := e.apply(Config{})
+		if err != nil {
+			fatal("Invalid --channel-ttls: %v", err)
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	return cfgs
+}
+
+// persistedConfig returns cfg as it is to be saved to CONFIG_FILE: configs of
+// --channel-ttls are not saved, but the configs in CONFIG_FILE they override
+// are.
+func persistedConfig(cfg Config) (Config, bool) {
+	if !cfg.fromEnv {
+		return cfg, true
+	}
+	if cfg.fileConfig != nil {
+		return *cfg.fileConfig, true
+	}
+	return Config{}, false
+}
+
+// patternConfig returns the config of the first pattern matching name.  It
+// requires CONFIG_LOCK to be held.
+func patternConfig(name string) (Config, bool) {
+	for _, cfg := range CHANNEL_PATTERNS {
+		if ok, _ := path.Match(cfg.Channel, name); ok {
+			cfg.Channel = name
+			return cfg, true
+		}
+	}
+	return Config{}, false
+}
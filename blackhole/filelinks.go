@@ -0,0 +1,40 @@
+package blackhole
+
+import (
+	"github.com/slack-go/slack"
+)
+
+// revokeFileLinks revokes the public link of file and deletes its comments
+// before the file is deleted if revoke_public_links is set for ch.
+// Failures are logged and don't prevent the deletion.
+func revokeFileLinks(ch string, file *slack.File) {
+	if !channelConfig(ch).RevokePublicLinks || isCanvas(file) {
+		return
+	}
+	fields := fileLog("revoke", file.ID)
+	if !slackOnly("revoke_public_links", fields) {
+		return
+	}
+	waitAPI("files.info")
+	f, comments, _, err := RTM.GetFileInfo(file.ID, 100, 1)
+	if err != nil {
+		fields.errorlog("GetFileInfo(%s) failed: %v", file.ID, err)
+		return
+	}
+	if f.PublicURLShared {
+		waitAPI("files.revokePublicURL")
+		if _, err := RTM.RevokeFilePublicURL(file.ID); err != nil {
+			fields.errorlog("RevokeFilePublicURL(%s) failed: %v", file.ID, err)
+		} else {
+			fields.info("Public link of file %s is revoked", file.ID)
+		}
+	}
+	for _, c := range comments {
+		waitAPI("files.comments.delete")
+		if err := RTM.DeleteFileComment(c.ID, file.ID); err != nil {
+			fields.errorlog("DeleteFileComment(%s, %s) failed: %v", c.ID, file.ID, err)
+		} else {
+			fields.info("Comment %s on file %s is deleted", c.ID, file.ID)
+		}
+	}
+}
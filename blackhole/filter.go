@@ -0,0 +1,74 @@
+package blackhole
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+func isBotMessage(msg *slack.Message) bool {
+	return msg.BotID != "" || msg.SubType == "bot_message"
+}
+
+// appOf returns the entry of apps which matches the app or the bot which
+// posted msg, or "" if none matches.  An entry is an app ID like
+// "A0F7XDUAZ", a bot ID like "B0F7XDUAZ" or a bot name like "GitHub".
+func appOf(apps []string, msg *slack.Message) string {
+	var ids []string
+	if msg.BotID != "" {
+		ids = append(ids, msg.BotID)
+	}
+	var name string
+	if p := msg.BotProfile; p != nil {
+		ids = append(ids, p.ID, p.AppID)
+		name = p.Name
+	}
+	if name == "" && msg.SubType == "bot_message" {
+		name = msg.Username
+	}
+	for _, app := range apps {
+		for _, id := range ids {
+			if id != "" && app == id {
+				return app
+			}
+		}
+		if name != "" && strings.EqualFold(app, name) {
+			return app
+		}
+	}
+	return ""
+}
+
+// exemption returns the reason why msg in ch is exempted from deletion, or
+// "" if it is not.
+func exemption(ch string, msg *slack.Message) string {
+	return exemptionBy(channelConfig(ch), ch, msg)
+}
+
+// exemptionBy is exemption with cfg as the config of ch.
+func exemptionBy(cfg Config, ch string, msg *slack.Message) string {
+	if isSummaryPost(cfg, msg) {
+		return "it is a summary (post_summary)"
+	}
+	bot := isBotMessage(msg)
+	if cfg.OnlyBots && !bot {
+		return "it is not from a bot (only_bots)"
+	}
+	if cfg.SkipBots && bot {
+		return "it is from a bot (skip_bots)"
+	}
+	if len(cfg.IncludeApps) > 0 && appOf(cfg.IncludeApps, msg) == "" {
+		return "it is not from the apps (include_apps)"
+	}
+	if app := appOf(cfg.ExcludeApps, msg); app != "" {
+		return fmt.Sprintf("it is from %s (exclude_apps)", app)
+	}
+	if p := cfg.keepPattern(msg.Text); p != "" {
+		return fmt.Sprintf("it matches %q", p)
+	}
+	if user := protectedBy(ch, msg.Timestamp); user != "" {
+		return fmt.Sprintf("it is protected by %s", user)
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package blackhole
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/slack-go/slack"
+)
+
+// compileKeepPatterns compiles KeepPatterns of cfg.
+func (cfg *Config) compileKeepPatterns() error {
+	cfg.keepRegexps = nil
+	for _, p := range cfg.KeepPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("keep_patterns of %s: %w", cfg.Channel, err)
+		}
+		cfg.keepRegexps = append(cfg.keepRegexps, re)
+	}
+	return nil
+}
+
+// keepPattern returns the keep pattern of ch which matches text or "" if
+// none matches.
+func keepPattern(ch, text string) string {
+	cfg := channelConfig(ch)
+	return cfg.keepPattern(text)
+}
+
+func (cfg *Config) keepPattern(text string) string {
+	for _, re := range cfg.keepRegexps {
+		if re.MatchString(text) {
+			return re.String()
+		}
+	}
+	return ""
+}
+
+// fetchMessage gets the current state of the message.  It returns nil if the
+// message is not found.
+func fetchMessage(ch string, msg *slack.Message) (*slack.Message, error) {
+	var msgs []slack.Message
+	switch {
+	case !isSlackBackend():
+		res, err := BACKEND.History(ch, msg.Timestamp, msg.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("History: %w", err)
+		}
+		msgs = res
+	case msg.ThreadTimestamp != "" && msg.ThreadTimestamp != msg.Timestamp:
+		waitAPI("conversations.replies")
+		res, _, _, err := RTM.GetConversationReplies(&slack.GetConversationRepliesParameters{
+			ChannelID: ch,
+			Timestamp: msg.ThreadTimestamp,
+			Latest:    msg.Timestamp,
+			Oldest:    msg.Timestamp,
+			Inclusive: true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("GetConversationReplies: %w", err)
+		}
+		msgs = res
+	default:
+		waitAPI("conversations.history")
+		res, err := RTM.GetConversationHistory(&slack.GetConversationHistoryParameters{
+			ChannelID: ch,
+			Latest:    msg.Timestamp,
+			Oldest:    msg.Timestamp,
+			Inclusive: true,
+			Limit:     1,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("GetConversationHistory: %w", err)
+		}
+		msgs = res.Messages
+	}
+	for i := range msgs {
+		if msgs[i].Timestamp == msg.Timestamp {
+			return &msgs[i], nil
+		}
+	}
+	return nil, nil
+}
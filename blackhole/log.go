@@ -0,0 +1,201 @@
+package blackhole
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelError
+	levelFatal
+)
+
+var levelNames = []string{"debug", "info", "error", "fatal"}
+
+// levelPrefixes are the prefixes used in text format
+var levelPrefixes = []string{"D", "I", "E", "F"}
+
+func (l logLevel) String() string {
+	return levelNames[l]
+}
+
+func parseLogLevel(s string) (logLevel, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return logLevel(i), nil
+		}
+	}
+	return levelInfo, fmt.Errorf("unknown log level: %s", s)
+}
+
+// logFields holds the structured part of a log entry.  Empty fields are
+// omitted from the output.
+type logFields struct {
+	Action  string `json:"action,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	TS      string `json:"ts,omitempty"`
+	File    string `json:"file,omitempty"`
+}
+
+type logEntry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	logFields
+}
+
+// maxRecentErrors is the number of recent error log entries kept for the
+// admin API.
+const maxRecentErrors = 100
+
+type logger struct {
+	mu           sync.Mutex
+	out          io.Writer
+	json         bool
+	level        logLevel
+	recentErrors []logEntry
+	secrets      []string
+}
+
+func newLogger(out io.Writer) *logger {
+	return &logger{out: out, level: levelInfo}
+}
+
+// redact registers secrets which are replaced with "[REDACTED]" in logs.
+func (l *logger) redact(secrets ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range secrets {
+		if s != "" {
+			l.secrets = append(l.secrets, s)
+		}
+	}
+}
+
+func (l *logger) write(level logLevel, fields logFields, msg string) {
+	if level < l.level {
+		return
+	}
+	now := time.Now().UTC()
+	msg = strings.TrimSuffix(msg, "\n")
+	l.mu.Lock()
+	for _, s := range l.secrets {
+		msg = strings.Replace(msg, s, "[REDACTED]", -1)
+	}
+	l.mu.Unlock()
+
+	var line []byte
+	if l.json {
+		data, err := json.Marshal(logEntry{
+			Time:      now.Format(time.RFC3339Nano),
+			Level:     level.String(),
+			Message:   msg,
+			logFields: fields,
+		})
+		if err != nil {
+			data = []byte(fmt.Sprintf(`{"level":"error","message":"Marshal log entry failed: %v"}`, err))
+		}
+		line = append(data, '\n')
+	} else {
+		line = []byte(fmt.Sprintf("%s %s: %s\n", now.Format("2006/01/02 15:04:05"), levelPrefixes[level], msg))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(line)
+	if level >= levelError {
+		l.recentErrors = append(l.recentErrors, logEntry{
+			Time:      now.Format(time.RFC3339Nano),
+			Level:     level.String(),
+			Message:   msg,
+			logFields: fields,
+		})
+		if len(l.recentErrors) > maxRecentErrors {
+			l.recentErrors = l.recentErrors[1:]
+		}
+	}
+}
+
+// errors returns the recent error log entries.
+func (l *logger) errors() []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]logEntry{}, l.recentErrors...)
+}
+
+// Output implements the logger interface of slack-go.  Messages from the
+// library are logged at debug level.
+func (l *logger) Output(calldepth int, s string) error {
+	l.write(levelDebug, logFields{Action: "slack"}, s)
+	return nil
+}
+
+func initLog() {
+	log = newLogger(os.Stdout)
+}
+
+func configureLog() {
+	switch LOG_FORMAT {
+	case "text":
+		log.json = false
+	case "json":
+		log.json = true
+	default:
+		fatal("Unknown log format: %s", LOG_FORMAT)
+	}
+	level, err := parseLogLevel(LOG_LEVEL)
+	if err != nil {
+		fatal("%v", err)
+	}
+	if DEBUG {
+		level = levelDebug
+	}
+	log.level = level
+}
+
+func messageLog(action, ch, ts string) logFields {
+	return logFields{Action: action, Channel: ch, TS: ts}
+}
+
+func fileLog(action, id string) logFields {
+	return logFields{Action: action, File: id}
+}
+
+func (f logFields) debug(fmtstr string, args ...interface{}) {
+	log.write(levelDebug, f, fmt.Sprintf(fmtstr, args...))
+}
+
+func (f logFields) info(fmtstr string, args ...interface{}) {
+	log.write(levelInfo, f, fmt.Sprintf(fmtstr, args...))
+}
+
+func (f logFields) errorlog(fmtstr string, args ...interface{}) {
+	log.write(levelError, f, fmt.Sprintf(fmtstr, args...))
+}
+
+func debug(fmtstr string, args ...interface{}) {
+	logFields{}.debug(fmtstr, args...)
+}
+
+func info(fmtstr string, args ...interface{}) {
+	logFields{}.info(fmtstr, args...)
+}
+
+func errorlog(fmtstr string, args ...interface{}) {
+	logFields{}.errorlog(fmtstr, args...)
+}
+
+func fatal(fmtstr string, args ...interface{}) {
+	stopTUI()
+	log.write(levelFatal, logFields{}, fmt.Sprintf(fmtstr, args...))
+	os.Exit(1)
+}
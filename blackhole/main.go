@@ -0,0 +1,1166 @@
+package blackhole
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+var (
+	log *logger
+
+	API_READY    <-chan time.Time
+	RTM          *slack.RTM
+	CONFIG_BY_ID map[string]Config
+	CONFIG_LOCK  sync.RWMutex
+	SELF_USER_ID string
+	SELF_IS_BOT  bool
+
+	// flags
+	ADMIN_API_ADDR             string
+	ADMIN_API_TOKEN            string
+	ADMIN_PERSIST_CONFIG       bool
+	ALERT_ERROR_THRESHOLD      int
+	ALERT_ERROR_WINDOW         time.Duration
+	ALERT_WEBHOOK              string
+	ALERT_WEBHOOK_FORMAT       string
+	ALLOW_SHORT_TTL            bool
+	API_RATE_TIER1             int
+	API_RATE_TIER2             int
+	API_RATE_TIER3             int
+	API_RATE_TIER4             int
+	AUDIT_FILE                 string
+	AUDIT_SNIPPET_LENGTH       int
+	AUDIT_TEXT                 string
+	AUDIT_WEBHOOK              string
+	AUTO_JOIN                  bool
+	BACKEND_NAME               string
+	BACKFILL                   bool
+	BACKFILL_CHANNELS          string
+	BACKFILL_FROM              string
+	BACKFILL_TIMEOUT           time.Duration
+	BACKFILL_TO                string
+	BACKLOG_CONFIRM_THRESHOLD  int
+	BACKLOG_SPREAD             time.Duration
+	CANVASES_BOOKMARKS         bool
+	CATCH_UP                   bool
+	CATCH_UP_MARGIN            time.Duration
+	CHANNEL_TTLS               string
+	CHECK_PERMISSIONS          bool
+	CLEANUP_TOMBSTONES         bool
+	CONFIG_FILE                string
+	CONFIRM_BACKLOG            bool
+	DEAD_LETTER_FILE           string
+	DEBUG                      bool
+	DEBUG_SLACK                bool
+	DEFAULT_FILE_TTL           int
+	DEFAULT_MESSAGE_TTL        int
+	DELETE_FILES_WITH_MESSAGE  bool
+	DELETE_WINDOW              string
+	DELETE_WINDOW_TZ           string
+	DELETION_WORKERS           int
+	DRY_RUN                    bool
+	ERROR_CLASSES              string
+	EXCLUDE_CHANNELS           string
+	LOG_FORMAT                 string
+	LOG_LEVEL                  string
+	MATTERMOST_TOKEN           string
+	MATTERMOST_URL             string
+	MAX_DELETIONS_PER_SWEEP    int
+	MAX_FILE_BYTES             int64
+	MAX_RETRIES                int
+	MAX_RETRIES_PERMANENT      int
+	MIN_TTL                    time.Duration
+	MULTI_CHANNEL_FILE_POLICY  string
+	OTLP_ENDPOINT              string
+	OTLP_SERVICE_NAME          string
+	POLICY_MODE                string
+	PROTECTED_FILE             string
+	PROTECT_CALLBACK_ID        string
+	QUERY_RETENTION            bool
+	RETRY_BACKOFF              time.Duration
+	RETRY_BACKOFF_PERMANENT    time.Duration
+	SCAN_CONCURRENCY           int
+	SCHEDULED_MESSAGES         bool
+	SHADOW_CONFIG_FILE         string
+	SHOW_CONFIG_FORMAT         string
+	SHUTDOWN_TIMEOUT           time.Duration
+	SLACK_API_INTERVAL         int
+	SLACK_API_TOKEN            string
+	SLACK_API_TOKEN_FILE       string
+	SLACK_RETENTION            time.Duration
+	SLACK_SIGNING_SECRET       string
+	SLACK_USER_TOKEN           string
+	SLACK_USER_TOKEN_FILE      string
+	SLASH_COMMAND_ADDR         string
+	STATS_FILE                 string
+	SWEEP_INTERVAL             time.Duration
+	SWEEP_JITTER               time.Duration
+	TOKEN_COMMAND              string
+	TOPIC_DIRECTIVES           bool
+	TOPIC_DIRECTIVE_PRECEDENCE string
+	TUI_MODE                   bool
+)
+
+func jsonString(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+func newSlackClient() *slack.Client {
+	if SLACK_API_TOKEN == "" {
+		fatal("BLACKHOLE_SLACK_API_TOKEN is not set")
+	}
+	api := slack.New(SLACK_API_TOKEN)
+	slack.OptionLog(log)(api)
+	if DEBUG_SLACK {
+		slack.OptionDebug(true)(api)
+	}
+	return api
+}
+
+// initSlackClient initializes RTM for Web API calls without connecting to
+// the RTM API.
+func initSlackClient() {
+	RTM = newSlackClient().NewRTM()
+	initSlackBackend()
+}
+
+func initSlackRTMClient() {
+	api := newSlackClient()
+	waitAPI("rtm.connect")
+	RTM = api.NewRTM()
+	go RTM.ManageConnection()
+
+	waitAPI("auth.test")
+	at, err := api.AuthTest()
+	if err != nil {
+		fatal("AuthTest failed: %v", err)
+	}
+	info("Connected to %s as %s", at.Team, at.User)
+	SELF_USER_ID = at.UserID
+	SELF_IS_BOT = at.BotID != ""
+	initUserClient()
+	initSlackBackend()
+	checkPermissions(at)
+	if CHECK_PERMISSIONS {
+		os.Exit(0)
+	}
+}
+
+type Config struct {
+	Channel    string `json:"channel"`
+	MessageTTL int    `json:"message_ttl"`
+	FileTTL    int    `json:"file_ttl"`
+
+	// MaxMessages is the number of the latest messages to be kept.  Older
+	// messages are deleted on sweeps regardless of MessageTTL.
+	MaxMessages int `json:"max_messages,omitempty"`
+
+	// MaxFileBytes is the budget for the total size of files in the
+	// channel.  The oldest files are deleted on sweeps while the total
+	// exceeds it regardless of FileTTL.
+	MaxFileBytes int64 `json:"max_file_bytes,omitempty"`
+
+	// DeleteWindow is the daily time window like "02:00-05:00" in which
+	// deletions are executed.
+	DeleteWindow string `json:"delete_window,omitempty"`
+
+	// KeepPatterns are regular expressions.  Messages whose text matches
+	// any of them are never deleted.
+	KeepPatterns []string `json:"keep_patterns,omitempty"`
+
+	// KeepSaved makes messages saved for later (starred) or referenced by
+	// open reminders kept.  They are checked when the messages are due.
+	KeepSaved bool `json:"keep_saved,omitempty"`
+
+	// TTLFromEdit makes the TTL of edited messages count from the last
+	// edit instead of the post.
+	TTLFromEdit bool `json:"ttl_from_edit,omitempty"`
+
+	// TTLAfterInactivity makes the TTL of all messages in the channel
+	// count from the latest message in the channel.  Messages are kept
+	// while the channel is active.
+	TTLAfterInactivity bool `json:"ttl_after_inactivity,omitempty"`
+
+	// OnlyBots makes only messages from bots deleted in the channel.
+	OnlyBots bool `json:"only_bots,omitempty"`
+
+	// SkipBots makes messages from bots kept in the channel.
+	SkipBots bool `json:"skip_bots,omitempty"`
+
+	// IncludeApps makes only messages from the apps deleted in the
+	// channel.  An app is an app ID, a bot ID or a bot name.
+	IncludeApps []string `json:"include_apps,omitempty"`
+
+	// ExcludeApps makes messages from the apps kept in the channel.
+	ExcludeApps []string `json:"exclude_apps,omitempty"`
+
+	// WarnBefore is the duration like "10m".  The author of a message is
+	// notified the duration before the message is deleted.
+	WarnBefore string `json:"warn_before,omitempty"`
+
+	// WarnReaction is the name of the reaction added to messages for the
+	// notification.  An ephemeral message is posted if it is empty.
+	WarnReaction string `json:"warn_reaction,omitempty"`
+
+	// ExpiryPreview makes messages annotated with when they will be
+	// deleted: "reaction" adds a reaction of the days left which is
+	// updated daily, and "note" posts an ephemeral note to the author in
+	// the thread.
+	ExpiryPreview string `json:"expiry_preview,omitempty"`
+
+	// DeleteFilesWithMessage overrides --delete-files-with-message for the
+	// channel.
+	DeleteFilesWithMessage *bool `json:"delete_files_with_message,omitempty"`
+
+	// SweepInterval is the duration like "6h" which overrides
+	// --sweep-interval for the channel.
+	SweepInterval string `json:"sweep_interval,omitempty"`
+
+	// CanvasTTL is the TTL of canvases in the channel.  Requires
+	// --canvases-bookmarks.
+	CanvasTTL int `json:"canvas_ttl,omitempty"`
+
+	// BookmarkTTL makes bookmarks of the channel removed on sweeps if they
+	// have not been updated for the TTL.  Requires --canvases-bookmarks.
+	BookmarkTTL int `json:"bookmark_ttl,omitempty"`
+
+	// ReactionTTL makes reactions on messages older than the TTL removed
+	// on sweeps while the messages are kept.
+	ReactionTTL int `json:"reaction_ttl,omitempty"`
+
+	// ReactionScope is "own" (default) to remove only the reactions of
+	// the bot by reaction_ttl, or "all" to remove also those of the user
+	// of --slack-user-token.
+	ReactionScope string `json:"reaction_scope,omitempty"`
+
+	// RetainUntil is a calendar-based retention like "end_of_month+1",
+	// which is the end of the calendar month following the month of
+	// posting.  Deadlines by TTLs are postponed to the end of the period.
+	RetainUntil string `json:"retain_until,omitempty"`
+
+	// RetainTZ is the time zone of RetainUntil like "Asia/Tokyo".  The
+	// default is UTC.
+	RetainTZ string `json:"retain_tz,omitempty"`
+
+	// RevokePublicLinks makes the public links of files revoked and their
+	// comments deleted before the files are deleted.
+	RevokePublicLinks bool `json:"revoke_public_links,omitempty"`
+
+	// PostSummary makes a summary of deletions posted to the channel.
+	PostSummary *SummaryConfig `json:"post_summary,omitempty"`
+
+	keepRegexps   []*regexp.Regexp
+	retainUntil   *calendarRule
+	warnBefore    time.Duration
+	sweepInterval time.Duration
+	summaryEvery  time.Duration
+	fromEnv       bool
+	fileConfig    *Config
+}
+
+// compile validates cfg and prepares unexported fields.
+func (cfg *Config) compile() error {
+	ttls := []struct {
+		name string
+		ttl  int
+	}{
+		{"message_ttl", cfg.MessageTTL},
+		{"file_ttl", cfg.FileTTL},
+		{"canvas_ttl", cfg.CanvasTTL},
+		{"bookmark_ttl", cfg.BookmarkTTL},
+		{"reaction_ttl", cfg.ReactionTTL},
+	}
+	for _, t := range ttls {
+		if t.ttl < 0 {
+			return fmt.Errorf("%s of %s must not be negative", t.name, cfg.Channel)
+		}
+		if err := checkMinTTL(t.name+" of "+cfg.Channel, t.ttl); err != nil {
+			return err
+		}
+	}
+	if cfg.DeleteWindow != "" {
+		if _, err := parseTimeWindow(cfg.DeleteWindow); err != nil {
+			return fmt.Errorf("delete_window of %s: %w", cfg.Channel, err)
+		}
+	}
+	if cfg.OnlyBots && cfg.SkipBots {
+		return fmt.Errorf("only_bots and skip_bots of %s are exclusive", cfg.Channel)
+	}
+	if len(cfg.IncludeApps) > 0 && (len(cfg.ExcludeApps) > 0 || cfg.SkipBots) {
+		return fmt.Errorf("include_apps of %s is exclusive with exclude_apps and skip_bots", cfg.Channel)
+	}
+	if err := cfg.compileKeepPatterns(); err != nil {
+		return err
+	}
+	if cfg.WarnBefore != "" {
+		d, err := parseDuration(cfg.WarnBefore)
+		if err != nil {
+			return fmt.Errorf("warn_before of %s: %w", cfg.Channel, err)
+		}
+		cfg.warnBefore = d
+	}
+	if cfg.RetainUntil != "" {
+		r, err := parseCalendarRule(cfg.RetainUntil, cfg.RetainTZ)
+		if err != nil {
+			return fmt.Errorf("retain_until of %s: %w", cfg.Channel, err)
+		}
+		cfg.retainUntil = r
+	} else if cfg.RetainTZ != "" {
+		return fmt.Errorf("retain_tz of %s needs retain_until", cfg.Channel)
+	}
+	switch cfg.ReactionScope {
+	case "", "own", "all":
+	default:
+		return fmt.Errorf("reaction_scope of %s must be own or all", cfg.Channel)
+	}
+	switch cfg.ExpiryPreview {
+	case "", "reaction", "note":
+	default:
+		return fmt.Errorf("expiry_preview of %s must be reaction or note", cfg.Channel)
+	}
+	if cfg.SweepInterval != "" {
+		d, err := parseDuration(cfg.SweepInterval)
+		if err != nil {
+			return fmt.Errorf("sweep_interval of %s: %w", cfg.Channel, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("sweep_interval of %s must be positive", cfg.Channel)
+		}
+		cfg.sweepInterval = d
+	}
+	if cfg.PostSummary != nil {
+		d, err := cfg.PostSummary.compile()
+		if err != nil {
+			return fmt.Errorf("post_summary of %s: %w", cfg.Channel, err)
+		}
+		cfg.summaryEvery = d
+	}
+	return nil
+}
+
+func initTTL() {
+	if CONFIG_FILE == "" && CHANNEL_TTLS == "" {
+		info("Neither CONFIG_FILE nor CHANNEL_TTLS is specified")
+		return
+	}
+	channels, err := BACKEND.ListConversations()
+	if err != nil {
+		fatal("getting the list of channels failed: %v", err)
+	}
+	loadConfig(channels)
+}
+
+// readConfigFile reads and validates the config file name.
+func readConfigFile(name string) []Config {
+	f, err := os.Open(name)
+	if err != nil {
+		fatal("Open(%s) failed: %v", name, err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		fatal("ReadAll failed: %v", err)
+	}
+	cfgs := []Config{}
+	err = json.Unmarshal(data, &cfgs)
+	if err != nil {
+		fatal("Unmarshal(%s) failed: %v", name, err)
+	}
+	for i := range cfgs {
+		if err := cfgs[i].compile(); err != nil {
+			fatal("Invalid config: %v", err)
+		}
+	}
+	return cfgs
+}
+
+// loadConfig loads CONFIG_FILE and --channel-ttls and binds the configs to
+// channels by name.
+func loadConfig(channels []slack.Channel) {
+	cfgs := readConfigs()
+	info("Config: %v", cfgs)
+
+	channelId := make(map[string]string)
+	for _, ch := range channels {
+		debug("channelId[%s]: %s", ch.Name, ch.ID)
+		channelId[ch.Name] = ch.ID
+	}
+	for _, cfg := range cfgs {
+		if cfg.fromEnv && isChannelPattern(cfg.Channel) {
+			CONFIG_LOCK.Lock()
+			CHANNEL_PATTERNS = append(CHANNEL_PATTERNS, cfg)
+			CONFIG_LOCK.Unlock()
+			continue
+		}
+		id, ok := channelId[cfg.Channel]
+		if !ok {
+			info("Channel %s is not found; the config is applied when it appears", cfg.Channel)
+			CONFIG_LOCK.Lock()
+			UNBOUND_CONFIGS[cfg.Channel] = cfg
+			CONFIG_LOCK.Unlock()
+			continue
+		}
+		info("CONFIG_BY_ID[%s]: %v", id, cfg)
+		setChannelConfig(id, cfg)
+	}
+	for _, ch := range channels {
+		CONFIG_LOCK.Lock()
+		_, ok := CONFIG_BY_ID[ch.ID]
+		cfg, matched := patternConfig(ch.Name)
+		if !ok && matched {
+			info("CONFIG_BY_ID[%s]: %v (by pattern)", ch.ID, cfg)
+			CONFIG_BY_ID[ch.ID] = cfg
+		}
+		CONFIG_LOCK.Unlock()
+	}
+}
+
+func channelConfig(ch string) Config {
+	CONFIG_LOCK.RLock()
+	defer CONFIG_LOCK.RUnlock()
+	return CONFIG_BY_ID[ch]
+}
+
+func setChannelConfig(ch string, cfg Config) {
+	CONFIG_LOCK.Lock()
+	defer CONFIG_LOCK.Unlock()
+	CONFIG_BY_ID[ch] = cfg
+}
+
+// saveConfig writes the current configuration back to CONFIG_FILE.
+func saveConfig() error {
+	if CONFIG_FILE == "" {
+		return fmt.Errorf("CONFIG_FILE is not specified")
+	}
+	CONFIG_LOCK.RLock()
+	cfgs := []Config{}
+	for _, cfg := range CONFIG_BY_ID {
+		if cfg, ok := persistedConfig(cfg); ok {
+			cfgs = append(cfgs, cfg)
+		}
+	}
+	for _, cfg := range UNBOUND_CONFIGS {
+		if cfg, ok := persistedConfig(cfg); ok {
+			cfgs = append(cfgs, cfg)
+		}
+	}
+	CONFIG_LOCK.RUnlock()
+	sort.Slice(cfgs, func(i, j int) bool { return cfgs[i].Channel < cfgs[j].Channel })
+
+	data, err := json.MarshalIndent(cfgs, "", "\t")
+	if err != nil {
+		return fmt.Errorf("MarshalIndent: %w", err)
+	}
+	tmp := CONFIG_FILE + ".tmp"
+	err = ioutil.WriteFile(tmp, append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("WriteFile(%s): %w", tmp, err)
+	}
+	err = os.Rename(tmp, CONFIG_FILE)
+	if err != nil {
+		return fmt.Errorf("Rename(%s, %s): %w", tmp, CONFIG_FILE, err)
+	}
+	return nil
+}
+
+func getAllChannels(rtm *slack.RTM) ([]slack.Channel, error) {
+	params := &slack.GetConversationsParameters{}
+	var channels []slack.Channel
+	for cont := true; cont; {
+		waitAPI("conversations.list")
+		chs, nextCursor, err := rtm.GetConversations(params)
+		if err != nil {
+			return nil, fmt.Errorf("GetConversations: %w", err)
+		}
+		channels = append(channels, chs...)
+		params.Cursor = nextCursor
+		if nextCursor == "" {
+			cont = false
+		}
+	}
+	return channels, nil
+}
+
+func unixTime(s string) (time.Time, error) {
+	f, err := strconv.ParseFloat(s, 0)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec := int64(f)
+	nsec := int64((f - float64(sec)) * 1000000000)
+	return time.Unix(sec, nsec), nil
+}
+
+// parseDuration parses a duration like time.ParseDuration but also accepts
+// "d" for days, and a plain integer as seconds.
+func parseDuration(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+func toBeDeleted(timeStamp string, ttl int) (time.Time, error) {
+	ts, err := unixTime(timeStamp)
+	if err != nil {
+		return ts, err
+	}
+	return ts.Add(time.Duration(ttl) * time.Second), nil
+}
+
+func deleteMessage(ch string, msg *slack.Message, ttl int) {
+	ts := msg.Timestamp
+	if purgedBySlackFirst(ch, ttl) {
+		messageLog("skip", ch, ts).debug("Message %s(%s) is left to the Slack retention %v", ch, ts, slackRetention(ch))
+		return
+	}
+	tbd, err := messageDeadline(ch, msg, ttl)
+	if err != nil {
+		messageLog("schedule", ch, ts).errorlog("toBeDeleted() for message %s(%s) failed: %v", ch, ts, err)
+		return
+	}
+	tbd, backlog := paceBacklog(tbd)
+	p, ok := addPending("message", ch, ts, "", tbd, backlog)
+	if !ok {
+		messageLog("schedule", ch, ts).debug("Message %s(%s) is already scheduled", ch, ts)
+		return
+	}
+	messageLog("schedule", ch, ts).info("Message %s(%s) will be deleted at %v", ch, ts, tbd)
+	startExpiryPreview(ch, msg, p)
+	go func() {
+		defer forgetExpiryPreview(ch, ts)
+		waitWarnTime(ch, msg, p)
+		for {
+			if !p.waitDue() {
+				return
+			}
+			if isPaused(ch) {
+				messageLog("pause", ch, ts).info("Deletion of message %s(%s) is postponed until the channel is resumed", ch, ts)
+				p.setState("paused")
+				waitResumed(ch)
+			}
+			if deleteWindow(ch) != nil {
+				p.setState("window")
+			}
+			waitDeleteWindow(ch, messageLog("", ch, ts))
+			p.setState("checking")
+			next, keep := recheckMessage(ch, msg, ttl)
+			if keep {
+				p.done()
+				return
+			}
+			if !next.After(time.Now()) {
+				break
+			}
+			tbd = next
+			p.setDueAt(tbd)
+			p.setState("waiting")
+			messageLog("schedule", ch, ts).info("Deletion of message %s(%s) is postponed to %v", ch, ts, tbd)
+		}
+		if p.isCanceled() {
+			return
+		}
+		messageLog("delete", ch, ts).info("Delete message: %s(%s)", ch, ts)
+		if DRY_RUN {
+			p.done()
+			return
+		}
+		p.setState("queued")
+		submitDeletion(p, func() {
+			tryDeleteMessage(ch, msg, p, 0)
+		})
+	}()
+}
+
+// tryDeleteMessage calls the API to delete msg.  It runs in a deletion
+// worker and is submitted again after backoff if it fails.
+func tryDeleteMessage(ch string, msg *slack.Message, p *pendingItem, attempt int) {
+	ts := msg.Timestamp
+	p.setState("deleting")
+	waitAPI("chat.delete")
+	err := DELETER.DeleteMessage(ch, ts)
+	if err == nil || errorClass(err) == errorGone {
+		messageLog("deleted", ch, ts).info("Message deleted: %s(%s)", ch, ts)
+		if err == nil {
+			auditMessage(ch, msg)
+			recordSummary(ch, 1, 0)
+			recordStats(ch, channelStats{Messages: 1})
+		}
+		removeDeadLetter(messageDeadLetter(ch, msg))
+		p.done()
+		deleteMessageFiles(ch, msg)
+		return
+	}
+	messageLog("delete", ch, ts).errorlog("DeleteMessage(%s, %s) failed (%s): %v", ch, ts, errorClass(err), err)
+	recordDeletionError(messageLog("delete", ch, ts))
+	p.setError(err, false)
+	if backoff, ok := retryBackoff(err, attempt); ok {
+		p.setState("retrying")
+		time.AfterFunc(backoff, func() {
+			submitDeletion(p, func() {
+				tryDeleteMessage(ch, msg, p, attempt+1)
+			})
+		})
+		return
+	}
+	reason := giveUpReason(err, attempt+1)
+	messageLog("give_up", ch, ts).errorlog("Failed to delete message %s(%s) %s", ch, ts, reason)
+	alert(fmt.Sprintf("Failed to delete message %s(%s) %s", ch, ts, reason), messageLog("give_up", ch, ts))
+	p.setError(err, true)
+	recordStats(ch, channelStats{Failures: 1})
+	addDeadLetter(messageDeadLetter(ch, msg), err)
+	p.done()
+}
+
+func handleMessage(ch string, msg *slack.Message) {
+	messageLog("receive", ch, msg.Timestamp).info("Message: %s", jsonString(msg))
+	if msg.SubType == "message_deleted" {
+		// not a new message
+		return
+	}
+	if !POLICY.Managed(ch) {
+		messageLog("receive", ch, msg.Timestamp).debug("Channel %s is not managed", ch)
+		return
+	}
+	if msg.SubType == "message_changed" {
+		handleMessageChanged(ch, msg)
+		return
+	}
+	if !ownMessage(msg) {
+		touchChannel(ch, msg.Timestamp)
+	}
+	if reason := exemption(ch, msg); reason != "" {
+		messageLog("keep", ch, msg.Timestamp).info("Message %s(%s) is kept because %s", ch, msg.Timestamp, reason)
+		return
+	}
+	cfgttl := channelConfig(ch).MessageTTL
+	ttl := POLICY.MessageTTL(ch)
+	messageLog("receive", ch, msg.Timestamp).debug("Message %s(%s): cfgttl..%d ttl..%d", ch, msg.Timestamp, cfgttl, ttl)
+	if ttl > 0 {
+		deleteMessage(ch, msg, ttl)
+	}
+}
+
+func handleMessageEvent(msg *slack.MessageEvent) {
+	messageLog("event", msg.Channel, msg.Timestamp).info("MessageEvent: %s(%s)", msg.Channel, msg.Timestamp)
+	m := slack.Message(*msg)
+	handleTopicChange(msg.Channel, &m)
+	handleMessage(msg.Channel, &m)
+}
+
+func deleteFile(ch string, file *slack.File, ttl int) {
+	if !canDeleteFiles() {
+		fileLog("skip", file.ID).debug("File %s is not deleted since --backend=%s can't delete files", file.ID, BACKEND_NAME)
+		return
+	}
+	ts := file.Timestamp.Time()
+	tbd := fileDeadline(ch, file, ttl)
+	tbd, backlog := paceBacklog(tbd)
+	p, ok := addPending("file", ch, "", file.ID, tbd, backlog)
+	if !ok {
+		fileLog("schedule", file.ID).debug("File %s is already scheduled", file.ID)
+		return
+	}
+	fileLog("schedule", file.ID).info("File %s (name='%s' title='%s') created %v (ttl=%d) will be deleted at %v", file.ID, file.Name, file.Title, ts, ttl, tbd)
+	go func() {
+		if !p.waitDue() {
+			return
+		}
+		if isPaused(ch) {
+			fileLog("pause", file.ID).info("Deletion of file %s is postponed until channel %s is resumed", file.ID, ch)
+			p.setState("paused")
+			waitResumed(ch)
+		}
+		if deleteWindow(ch) != nil {
+			p.setState("window")
+		}
+		waitDeleteWindow(ch, fileLog("", file.ID))
+		if p.isCanceled() {
+			return
+		}
+		fileLog("delete", file.ID).info("Delete File: id=%s name='%s' title='%s'", file.ID, file.Name, file.Title)
+		if DRY_RUN {
+			p.done()
+			return
+		}
+		p.setState("queued")
+		submitDeletion(p, func() {
+			tryDeleteFile(ch, file, p, 0)
+		})
+	}()
+}
+
+// tryDeleteFile calls the API to delete file.  It runs in a deletion worker
+// and is submitted again after backoff if it fails.
+func tryDeleteFile(ch string, file *slack.File, p *pendingItem, attempt int) {
+	p.setState("deleting")
+	if attempt == 0 {
+		revokeFileLinks(ch, file)
+	}
+	waitAPI(fileDeleteMethod(file))
+	err := DELETER.DeleteFile(file)
+	if err == nil || errorClass(err) == errorGone {
+		fileLog("deleted", file.ID).info("File deleted: %s", file.ID)
+		if err == nil {
+			auditFile(file)
+			recordSummary(ch, 0, 1)
+			recordStats(ch, channelStats{Files: 1, FileBytes: int64(file.Size)})
+		}
+		removeDeadLetter(fileDeadLetter(ch, file))
+		p.done()
+		return
+	}
+	fileLog("delete", file.ID).errorlog("DeleteFile(%s) failed (%s): %v", file.ID, errorClass(err), err)
+	recordDeletionError(fileLog("delete", file.ID))
+	p.setError(err, false)
+	if backoff, ok := retryBackoff(err, attempt); ok {
+		p.setState("retrying")
+		time.AfterFunc(backoff, func() {
+			submitDeletion(p, func() {
+				tryDeleteFile(ch, file, p, attempt+1)
+			})
+		})
+		return
+	}
+	reason := giveUpReason(err, attempt+1)
+	fileLog("give_up", file.ID).errorlog("Failed to delete file %s %s", file.ID, reason)
+	alert(fmt.Sprintf("Failed to delete file %s in %s %s", file.ID, ch, reason), fileLog("give_up", file.ID))
+	p.setError(err, true)
+	recordStats(ch, channelStats{Failures: 1})
+	addDeadLetter(fileDeadLetter(ch, file), err)
+	p.done()
+}
+
+func handleFile(file *slack.File) {
+	debug("handleFile: %s", jsonString(file))
+	if len(file.Channels) == 0 {
+		// file from File*Event doesn't have value in Channels field.
+		// Re-get if so.
+		waitAPI("files.info")
+		f, _, _, err := RTM.GetFileInfo(file.ID, 0, 1)
+		if err != nil {
+			fatal("GetFileInfo for %s failed: %v", file.ID, err)
+		}
+		file = f
+	}
+
+	if len(file.Channels) == 0 {
+		fileLog("skip", file.ID).info("File %s will not be deleted because of channel: %v", file.ID, file.Channels)
+		return
+	}
+	if isCanvas(file) && len(file.Channels) > 1 {
+		fileLog("skip", file.ID).info("Canvas %s will not be deleted because it is shared to channels: %v", file.ID, file.Channels)
+		return
+	}
+	if len(file.Channels) > 1 {
+		handleMultiChannelFile(file)
+		return
+	}
+	ch := file.Channels[0]
+	if !POLICY.Managed(ch) {
+		fileLog("skip", file.ID).debug("File %s will not be deleted because channel %s is not managed", file.ID, ch)
+		return
+	}
+	if isCanvas(file) {
+		handleCanvas(ch, file)
+		return
+	}
+	ttl := POLICY.FileTTL(ch)
+	if ttl > 0 {
+		deleteFile(ch, file, ttl)
+	}
+}
+
+func handleFileCreated(file *slack.FileCreatedEvent) {
+	fileLog("event", file.File.ID).info("File Created: %s", file.File.ID)
+	handleFile(&file.File)
+}
+
+func handleFileShared(file *slack.FileSharedEvent) {
+	fileLog("event", file.File.ID).info("File Shared: %s", file.File.ID)
+	handleFile(&file.File)
+}
+
+func inspectHistory(ch slack.Channel, sw *sweep) {
+	msgs, err := sw.history(ch.ID)
+	if err != nil {
+		fatal("History() for %s failed: %v", ch.ID, err)
+	}
+
+	inspectReactions(ch.ID, msgs, sw)
+	cfg := channelConfig(ch.ID)
+	max := cfg.MaxMessages
+	now := time.Now()
+	if POLICY.MessageTTL(ch.ID) == 0 && max == 0 {
+		// only reaction_ttl applies to the channel
+		for i := range msgs {
+			if !isTombstone(&msgs[i]) {
+				sw.shadowMessage(ch.ID, &msgs[i], i, now)
+			}
+		}
+		return
+	}
+
+	touchChannelHistory(ch.ID, msgs)
+	cleanupTombstones(ch.ID, msgs, sw)
+
+	// msgs are sorted from newest to oldest
+	for i := 0; i < len(msgs); i++ {
+		if isTombstone(&msgs[i]) {
+			continue
+		}
+		sw.shadowMessage(ch.ID, &msgs[i], i, now)
+		exceeded := max > 0 && i >= max
+		ttl := POLICY.MessageTTL(ch.ID)
+		if exceeded {
+			ttl = 0
+		}
+		if reason := exemption(ch.ID, &msgs[i]); reason != "" {
+			if !sw.estimate {
+				messageLog("keep", ch.ID, msgs[i].Timestamp).debug("Message %s(%s) is kept because %s", ch.ID, msgs[i].Timestamp, reason)
+			}
+			continue
+		}
+		if ttl > 0 || exceeded {
+			tbd, err := messageDeadline(ch.ID, &msgs[i], ttl)
+			if err == nil && !sw.admitMessage(ch.ID, tbd) {
+				continue
+			}
+		}
+		if sw.estimate {
+			continue
+		}
+		if exceeded {
+			messageLog("max_messages", ch.ID, msgs[i].Timestamp).debug("Message %s(%s) exceeds max_messages %d", ch.ID, msgs[i].Timestamp, max)
+			deleteMessage(ch.ID, &msgs[i], 0)
+			continue
+		}
+		handleMessage(ch.ID, &msgs[i])
+	}
+}
+
+func inspectFiles(sw *sweep) {
+	allFiles, err := BACKEND.ListFiles(time.Time{}, time.Time{})
+	if err != nil {
+		fatal("ListFiles() failed: %v", err)
+	}
+	now := time.Now()
+	for i := 0; i < len(allFiles); i++ {
+		sw.shadowFile(&allFiles[i], now)
+		if !sw.admitFile(&allFiles[i], false) {
+			continue
+		}
+		handleFile(&allFiles[i])
+	}
+
+	enforceFileBudget(allFiles, sw)
+}
+
+func inspectChannel(ch slack.Channel, sw *sweep, now time.Time) {
+	cfg := channelConfig(ch.ID)
+	setChannelTextOf(ch)
+	history := POLICY.MessageTTL(ch.ID) != 0 || cfg.MaxMessages != 0 || cfg.ReactionTTL != 0
+	bookmarks := CANVASES_BOOKMARKS && cfg.BookmarkTTL != 0
+	if !POLICY.Managed(ch.ID) || !history && !bookmarks {
+		sw.shadowHistory(ch)
+		return
+	}
+	if !ensureMembership(ch, !sw.estimate) {
+		return
+	}
+	if !sw.dueForSweep(ch.ID, sweepInterval(ch.ID), now) {
+		return
+	}
+	inspectBookmarks(ch.ID, sw)
+	if !history {
+		sw.shadowHistory(ch)
+		return
+	}
+	inspectHistory(ch, sw)
+}
+
+// inspectChannels inspects channels by --scan-concurrency workers, which
+// share the rate limits of the API, and then files.
+func inspectChannels(channels []slack.Channel, sw *sweep) {
+	now := time.Now()
+	sem := make(chan struct{}, SCAN_CONCURRENCY)
+	var wg sync.WaitGroup
+	for _, ch := range channels {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(ch slack.Channel) {
+			defer wg.Done()
+			inspectChannel(ch, sw, now)
+			<-sem
+		}(ch)
+	}
+	wg.Wait()
+
+	if sw.dueForSweep("", SWEEP_INTERVAL, now) {
+		inspectFiles(sw)
+		inspectScheduledMessages(sw)
+	}
+}
+
+// inspectPast sweeps messages and files in all channels.  On the first sweep,
+// the backlog of expired messages and files is estimated and has to be
+// confirmed before deletion unless --confirm-backlog is set.
+func inspectPast(first bool) {
+	channels, err := BACKEND.ListConversations()
+	if err != nil {
+		fatal("getting the list of channels failed: %v", err)
+	}
+	info("There are %d channels", len(channels))
+	var estimate *sweep
+	if first && !CONFIRM_BACKLOG {
+		estimate = newSweep(channels, true)
+		inspectChannels(channels, estimate)
+		estimate.report()
+		confirmBacklog(estimate)
+	}
+
+	setKnownChannels(channels)
+	queryRetention(channels)
+	if n := retryDeadLetters(false); n > 0 {
+		info("Retrying %d failed deletions", n)
+	}
+	sw := newSweep(channels, false)
+	if estimate != nil {
+		// the channels have just been scanned by the estimate
+		sw.histories = estimate.histories
+	}
+	inspectChannels(channels, sw)
+	sw.report()
+}
+
+func setFromEnv(f *flag.Flag) {
+	envKey := "BLACKHOLE_" + strings.Replace(strings.ToUpper(f.Name), "-", "_", -1)
+	envVal := os.Getenv(envKey)
+	if envVal != "" {
+		err := flag.Set(f.Name, envVal)
+		if err != nil {
+			fatal("Cannot set flag %s=%s from environment %s: %v", f.Name, envVal, envKey, err)
+		}
+	}
+}
+
+func init() {
+	initLog()
+	CONFIG_BY_ID = make(map[string]Config)
+}
+
+// RegisterFlags registers the flags of slack-blackhole to fs.
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&ADMIN_API_ADDR, "admin-api-addr", "", "Address to listen on for the admin API (e.g. 127.0.0.1:8081)")
+	fs.StringVar(&ADMIN_API_TOKEN, "admin-api-token", "", "Bearer token required for the admin API")
+	fs.BoolVar(&ADMIN_PERSIST_CONFIG, "admin-persist-config", false, "Save changes by admin commands to the config file")
+	fs.IntVar(&ALERT_ERROR_THRESHOLD, "alert-error-threshold", 0, "Number of deletion failures in --alert-error-window to send an alert (0 means disabled)")
+	fs.DurationVar(&ALERT_ERROR_WINDOW, "alert-error-window", 10*time.Minute, "Time window for --alert-error-threshold")
+	fs.StringVar(&ALERT_WEBHOOK, "alert-webhook", "", "URL to POST alerts on deletion failures to")
+	fs.StringVar(&ALERT_WEBHOOK_FORMAT, "alert-webhook-format", "slack", "Format of alerts (slack for incoming webhooks, or json)")
+	fs.BoolVar(&ALLOW_SHORT_TTL, "allow-short-ttl", false, "Allow TTLs shorter than --min-ttl")
+	fs.IntVar(&API_RATE_TIER1, "api-rate-tier1", 1, "Calls per minute of each Tier 1 API method (0 means no limit)")
+	fs.IntVar(&API_RATE_TIER2, "api-rate-tier2", 20, "Calls per minute of each Tier 2 API method (0 means no limit)")
+	fs.IntVar(&API_RATE_TIER3, "api-rate-tier3", 50, "Calls per minute of each Tier 3 API method like chat.delete and conversations.history (0 means no limit)")
+	fs.IntVar(&API_RATE_TIER4, "api-rate-tier4", 100, "Calls per minute of each Tier 4 API method (0 means no limit)")
+	fs.StringVar(&AUDIT_FILE, "audit-file", "", "File to append audit records of deletions to")
+	fs.IntVar(&AUDIT_SNIPPET_LENGTH, "audit-snippet-length", 50, "Length of message text snippets in audit records")
+	fs.StringVar(&AUDIT_TEXT, "audit-text", "none", "Message text recorded in audit records (none, snippet or hash)")
+	fs.StringVar(&AUDIT_WEBHOOK, "audit-webhook", "", "URL to POST audit records of deletions to")
+	fs.BoolVar(&AUTO_JOIN, "auto-join", false, "Join public channels having a policy if the bot is not a member")
+	fs.StringVar(&BACKEND_NAME, "backend", "slack", "Chat service: slack or mattermost")
+	fs.BoolVar(&BACKFILL, "backfill", false, "Delete messages between --backfill-from and --backfill-to in --backfill-channels and exit")
+	fs.StringVar(&BACKFILL_CHANNELS, "backfill-channels", "", "Comma separated names of channels for --backfill")
+	fs.StringVar(&BACKFILL_FROM, "backfill-from", "", "First date like 2023-01-01 for --backfill")
+	fs.DurationVar(&BACKFILL_TIMEOUT, "backfill-timeout", time.Hour, "Time to wait for deletions of --backfill to be done (0 means no limit)")
+	fs.StringVar(&BACKFILL_TO, "backfill-to", "", "Last date like 2023-06-30 for --backfill")
+	fs.IntVar(&BACKLOG_CONFIRM_THRESHOLD, "backlog-confirm-threshold", 1000, "Number of expired messages/files on startup which requires confirmation to delete")
+	fs.DurationVar(&BACKLOG_SPREAD, "backlog-spread", 0, "Duration to spread deletions of already expired messages/files found by sweeps over")
+	fs.BoolVar(&CANVASES_BOOKMARKS, "canvases-bookmarks", false, "Delete canvases and remove bookmarks according to canvas_ttl and bookmark_ttl (requires canvases:write, bookmarks:read and bookmarks:write scopes)")
+	fs.BoolVar(&CATCH_UP, "catch-up", true, "Catch up messages and files posted while the connection to Slack was down on reconnection")
+	fs.DurationVar(&CATCH_UP_MARGIN, "catch-up-margin", time.Minute, "Extra time before the disconnection to catch up")
+	fs.StringVar(&CHANNEL_TTLS, "channel-ttls", "", "TTLs of channels like general=7d:files=30d,tmp-*=24h in addition to --config-file")
+	fs.BoolVar(&CHECK_PERMISSIONS, "check-permissions", false, "Check permissions of the token and exit")
+	fs.BoolVar(&CLEANUP_TOMBSTONES, "cleanup-tombstones", false, "Delete tombstones of deleted thread parents whose replies are all gone")
+	fs.StringVar(&CONFIG_FILE, "config-file", "", "Configuration file")
+	fs.BoolVar(&CONFIRM_BACKLOG, "confirm-backlog", false, "Delete expired messages/files on startup without confirmation")
+	fs.StringVar(&DEAD_LETTER_FILE, "dead-letter-file", "", "File to save failed deletions to be retried after restart")
+	fs.BoolVar(&DEBUG, "debug", false, "Debug on (same as --log-level=debug)")
+	fs.BoolVar(&DEBUG_SLACK, "debug-slack", false, "Debug on for Slack")
+	fs.IntVar(&DEFAULT_MESSAGE_TTL, "default-message-ttl", 0, "TTL of messages for all channel")
+	fs.IntVar(&DEFAULT_FILE_TTL, "default-file-ttl", 0, "TTL of files for all channel")
+	fs.BoolVar(&DELETE_FILES_WITH_MESSAGE, "delete-files-with-message", false, "Delete files attached to messages with the messages")
+	fs.StringVar(&DELETE_WINDOW, "delete-window", "", "Daily time window (e.g. 02:00-05:00) in which deletions are executed")
+	fs.StringVar(&DELETE_WINDOW_TZ, "delete-window-tz", "UTC", "Time zone of delete windows")
+	fs.IntVar(&DELETION_WORKERS, "deletion-workers", 2, "Number of workers calling deletion APIs in parallel")
+	fs.BoolVar(&DRY_RUN, "dry-run", false, "Do not delete messages/files")
+	fs.StringVar(&ERROR_CLASSES, "error-classes", "", "Comma separated classes of error codes of deletions like cant_delete_message=transient (gone, permanent or transient)")
+	fs.StringVar(&EXCLUDE_CHANNELS, "exclude-channels", "", "Comma separated names of channels never touched")
+	fs.StringVar(&LOG_FORMAT, "log-format", "text", "Log format (text or json)")
+	fs.StringVar(&LOG_LEVEL, "log-level", "info", "Log level (debug, info or error)")
+	fs.StringVar(&MATTERMOST_TOKEN, "mattermost-token", "", "Mattermost personal access token or bot token (--backend=mattermost)")
+	fs.StringVar(&MATTERMOST_URL, "mattermost-url", "", "Mattermost server URL like https://mattermost.example.com (--backend=mattermost)")
+	fs.IntVar(&MAX_DELETIONS_PER_SWEEP, "max-deletions-per-sweep", 0, "Maximum number of expired messages/files deleted in a sweep (0 means unlimited)")
+	fs.Int64Var(&MAX_FILE_BYTES, "max-file-bytes", 0, "Budget (bytes) for the total size of files in the team")
+	fs.IntVar(&MAX_RETRIES, "max-retries", 5, "Maximum number of retries for message/file deletion")
+	fs.IntVar(&MAX_RETRIES_PERMANENT, "max-retries-permanent", 2, "Maximum number of tries including the first one for message/file deletion failing with permanent errors")
+	fs.DurationVar(&MIN_TTL, "min-ttl", time.Minute, "Minimum TTL as a safety guard against typos; shorter TTLs are refused")
+	fs.StringVar(&MULTI_CHANNEL_FILE_POLICY, "multi-channel-file-policy", "skip", "Policy for files shared to multiple channels (skip, strictest, longest or unshare)")
+	fs.StringVar(&OTLP_ENDPOINT, "otlp-endpoint", "", "OTLP/HTTP endpoint like http://localhost:4318/v1/traces to export traces of deletions to")
+	fs.StringVar(&OTLP_SERVICE_NAME, "otlp-service-name", "slack-blackhole", "service.name of exported traces")
+	fs.StringVar(&POLICY_MODE, "policy-mode", "denylist", "allowlist to touch only channels in the config file, or denylist to touch all channels except --exclude-channels")
+	fs.StringVar(&PROTECT_CALLBACK_ID, "protect-callback-id", "protect_from_blackhole", "Callback ID of the message shortcut to protect messages")
+	fs.StringVar(&PROTECTED_FILE, "protected-file", "", "File to save messages protected with the message shortcut")
+	fs.BoolVar(&QUERY_RETENTION, "query-retention", false, "Get custom retentions of channels with admin.conversations.getCustomRetention (Enterprise Grid)")
+	fs.DurationVar(&RETRY_BACKOFF, "retry-backoff", time.Second, "Initial backoff of retries of deletions, which is doubled every retry")
+	fs.DurationVar(&RETRY_BACKOFF_PERMANENT, "retry-backoff-permanent", time.Hour, "Initial backoff of retries of deletions failing with permanent errors")
+	fs.IntVar(&SCAN_CONCURRENCY, "scan-concurrency", 1, "Number of channels whose histories are inspected in parallel on sweeps")
+	fs.BoolVar(&SCHEDULED_MESSAGES, "scheduled-messages", false, "Delete messages scheduled by the app whose message TTL has expired since they were scheduled")
+	fs.StringVar(&SHADOW_CONFIG_FILE, "shadow-config-file", "", "New configuration file whose decisions are compared with --config-file on sweeps without being applied")
+	fs.StringVar(&SHOW_CONFIG_FORMAT, "show-config-format", "table", "Output format of show-config: table or json")
+	fs.DurationVar(&SHUTDOWN_TIMEOUT, "shutdown-timeout", 30*time.Second, "Time to wait for running deletions to be done on stop")
+	fs.IntVar(&SLACK_API_INTERVAL, "slack-api-interval", 0, "Interval (sec) for any API call in addition to --api-rate-tier* (0 means none)")
+	fs.StringVar(&SLACK_API_TOKEN, "slack-api-token", "", "Slack API token")
+	fs.StringVar(&SLACK_API_TOKEN_FILE, "slack-api-token-file", "", "File to read the Slack API token from")
+	fs.DurationVar(&SLACK_RETENTION, "slack-retention", 0, "Message retention of the workspace set in Slack; messages whose TTL is not shorter are left to Slack")
+	fs.StringVar(&SLACK_SIGNING_SECRET, "slack-signing-secret", "", "Slack signing secret for verifying slash commands")
+	fs.StringVar(&SLACK_USER_TOKEN, "slack-user-token", "", "Slack user (admin) token used for deletions along with the token of --slack-api-token")
+	fs.StringVar(&SLACK_USER_TOKEN_FILE, "slack-user-token-file", "", "File to read the Slack user token from")
+	fs.StringVar(&SLASH_COMMAND_ADDR, "slash-command-addr", "", "Address to listen on for /blackhole slash commands (e.g. :8080)")
+	fs.StringVar(&STATS_FILE, "stats-file", "", "File to save the deletion stats to so that they are kept across restarts")
+	fs.DurationVar(&SWEEP_INTERVAL, "sweep-interval", time.Hour, "Interval of sweeps of all channels")
+	fs.DurationVar(&SWEEP_JITTER, "sweep-jitter", 0, "Maximum random delay added to the sweep interval")
+	fs.StringVar(&TOKEN_COMMAND, "token-command", "", "Command whose output is used as the Slack API token, like a secret manager CLI")
+	fs.StringVar(&TOPIC_DIRECTIVE_PRECEDENCE, "topic-directive-precedence", "config", "Which wins when both the config file and a topic directive give a TTL: config or topic")
+	fs.BoolVar(&TOPIC_DIRECTIVES, "topic-directives", false, "Apply TTLs given by directives like [blackhole: 72h] in channel topics or purposes")
+	fs.BoolVar(&TUI_MODE, "tui", false, "Show a dashboard of events, the deletion queue, channels and errors on the terminal instead of logs")
+}
+
+// Main runs slack-blackhole with the command line arguments.
+func Main() {
+	RegisterFlags(flag.CommandLine)
+	flag.VisitAll(setFromEnv)
+
+	// A command may precede the flags like "slack-blackhole show-config
+	// --config-file config.json".
+	cmd := ""
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		cmd = os.Args[1]
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
+	configureLog()
+	initSecrets()
+	switch cmd {
+	case "":
+	case "show-config":
+		showConfig()
+		return
+	case "validate":
+		validate()
+		return
+	case "simulate":
+		simulate()
+		return
+	case "stats":
+		statsCommand()
+		return
+	default:
+		fatal("Unknown command: %s", cmd)
+	}
+	rand.Seed(time.Now().UnixNano())
+	if SWEEP_INTERVAL <= 0 {
+		fatal("--sweep-interval must be positive")
+	}
+	if SCAN_CONCURRENCY < 1 {
+		fatal("--scan-concurrency must be positive")
+	}
+	initMinTTL()
+	initTopicDirectives()
+	initAudit()
+	initAlert()
+	initTracing()
+	initDeadLetters()
+	initStats()
+	initProtected()
+	initDeleteWindow()
+	initMultiChannelFilePolicy()
+	initErrorClasses()
+	initPolicyMode()
+	initShadow()
+	initApiThrottle()
+	initDeletionWorkers()
+	if BACKFILL {
+		backfill()
+		return
+	}
+	initBackend()
+	initTTL()
+	initExcludeChannels()
+	initSlashCommand()
+	initAdminAPI()
+	initSummary()
+	handleSignals()
+	startWatchdog()
+	if TUI_MODE {
+		startTUI()
+	}
+
+	go func() {
+		for first := true; ; first = false {
+			inspectPast(first)
+			select {
+			case <-time.After(nextSweepWait()):
+			case <-SWEEP_NOW:
+			}
+		}
+	}()
+	for data := range BACKEND.Events() {
+		if handleConnectionEvent(data) {
+			continue
+		}
+		eventLoopAlive()
+		recordEvent(data)
+		switch ev := data.(type) {
+		//case *slack.HelloEvent:
+		case *slack.MessageEvent:
+			if strings.HasPrefix(ev.Channel, "D") {
+				go handleDirectMessage(ev)
+			}
+			handleMessageEvent(ev)
+		case *slack.FileCreatedEvent:
+			handleFileCreated(ev)
+		case *slack.FileSharedEvent:
+			handleFileShared(ev)
+		default:
+			if handleChannelEvent(ev) || handleMembershipEvent(ev) {
+				continue
+			}
+			debug("Event: %T %v", ev, ev)
+		}
+	}
+}
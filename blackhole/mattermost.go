@@ -0,0 +1,570 @@
+package blackhole
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/slack-go/slack"
+)
+
+// mattermostPerPage is the page size of the Mattermost API.
+const mattermostPerPage = 200
+
+// mattermostPingInterval is how often the WebSocket connection is pinged.
+// Pongs are sent as *slack.LatencyReport like RTM so that the event loop is
+// regarded as alive even if the workspace is quiet.
+const mattermostPingInterval = 30 * time.Second
+
+// mattermostPost is a post of the Mattermost API v4.
+type mattermostPost struct {
+	ID        string                 `json:"id"`
+	CreateAt  int64                  `json:"create_at"`
+	EditAt    int64                  `json:"edit_at"`
+	DeleteAt  int64                  `json:"delete_at"`
+	UserID    string                 `json:"user_id"`
+	ChannelID string                 `json:"channel_id"`
+	RootID    string                 `json:"root_id"`
+	Message   string                 `json:"message"`
+	Type      string                 `json:"type"`
+	Props     map[string]interface{} `json:"props"`
+	FileIDs   []string               `json:"file_ids"`
+	Metadata  struct {
+		Files []mattermostFile `json:"files"`
+	} `json:"metadata"`
+}
+
+type mattermostPostList struct {
+	Order []string                   `json:"order"`
+	Posts map[string]*mattermostPost `json:"posts"`
+}
+
+type mattermostFile struct {
+	ID        string `json:"id"`
+	PostID    string `json:"post_id"`
+	ChannelID string `json:"channel_id"`
+	UserID    string `json:"user_id"`
+	CreateAt  int64  `json:"create_at"`
+	DeleteAt  int64  `json:"delete_at"`
+	Name      string `json:"name"`
+	Extension string `json:"extension"`
+	Size      int    `json:"size"`
+	MimeType  string `json:"mime_type"`
+}
+
+type mattermostChannel struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Header      string `json:"header"`
+	Purpose     string `json:"purpose"`
+	DeleteAt    int64  `json:"delete_at"`
+}
+
+// mattermostEvent is a frame of the WebSocket API.  Values in Data are of
+// various types depending on the event.
+type mattermostEvent struct {
+	Event     string                     `json:"event"`
+	Data      map[string]json.RawMessage `json:"data"`
+	Broadcast struct {
+		ChannelID string `json:"channel_id"`
+	} `json:"broadcast"`
+}
+
+// mattermostBackend is the ChatBackend with the Mattermost API v4.  Posts
+// are identified by timestamps from their create_at and IDs in channels
+// like Slack messages.
+type mattermostBackend struct {
+	url    string
+	token  string
+	client *http.Client
+
+	mu sync.Mutex
+	// postIDs has the IDs of posts keyed by "channel/timestamp", and
+	// timestamps has the timestamps of posts keyed by the IDs.
+	postIDs    map[string]string
+	timestamps map[string]string
+}
+
+func newMattermostBackend(url, token string, client *http.Client) *mattermostBackend {
+	return &mattermostBackend{
+		url:        strings.TrimSuffix(url, "/"),
+		token:      token,
+		client:     client,
+		postIDs:    make(map[string]string),
+		timestamps: make(map[string]string),
+	}
+}
+
+// canDeleteFiles returns false if the backend can't delete files alone.
+func canDeleteFiles() bool {
+	_, ok := BACKEND.(*mattermostBackend)
+	return !ok
+}
+
+func initMattermost() {
+	if MATTERMOST_URL == "" {
+		fatal("--mattermost-url is not set")
+	}
+	if MATTERMOST_TOKEN == "" {
+		fatal("BLACKHOLE_MATTERMOST_TOKEN is not set")
+	}
+	log.redact(MATTERMOST_TOKEN)
+	for name, set := range map[string]bool{
+		"--canvases-bookmarks": CANVASES_BOOKMARKS,
+		"--check-permissions":  CHECK_PERMISSIONS,
+		"--query-retention":    QUERY_RETENTION,
+		"--scheduled-messages": SCHEDULED_MESSAGES,
+		"--slack-user-token":   SLACK_USER_TOKEN != "",
+		"--slash-command-addr": SLASH_COMMAND_ADDR != "",
+	} {
+		if set {
+			fatal("%s is not available with --backend=mattermost", name)
+		}
+	}
+	b := newMattermostBackend(MATTERMOST_URL, MATTERMOST_TOKEN, &http.Client{Timeout: 30 * time.Second})
+	var me struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+		IsBot    bool   `json:"is_bot"`
+	}
+	if err := b.call("GET", "/users/me", nil, &me); err != nil {
+		fatal("Getting the user of the Mattermost token failed: %v", err)
+	}
+	info("Connected to %s as %s", b.url, me.Username)
+	SELF_USER_ID = me.ID
+	BACKEND = b
+	if DELETER == nil {
+		DELETER = b
+	}
+}
+
+// mattermostError is an error response of the Mattermost API.
+type mattermostError struct {
+	status int
+	ID     string `json:"id"`
+	Msg    string `json:"message"`
+}
+
+func (e *mattermostError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.status, e.ID, e.Msg)
+}
+
+func isNotFound(err error) bool {
+	var e *mattermostError
+	return errors.As(err, &e) && e.status == http.StatusNotFound
+}
+
+// call calls the API at path with body in JSON, and decodes the response
+// into res unless it is nil.
+func (b *mattermostBackend) call(method, path string, body, res interface{}) error {
+	var r *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	} else {
+		r = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, b.url+"/api/v4"+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	req.Header.Set("Content-Type", "application/json")
+	waitAPI("mattermost")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		e := &mattermostError{status: resp.StatusCode}
+		json.Unmarshal(data, e)
+		return e
+	}
+	if res == nil {
+		return nil
+	}
+	return json.Unmarshal(data, res)
+}
+
+// mattermostTimestamp converts create_at (msec) to a Slack timestamp.
+func mattermostTimestamp(msec int64) string {
+	return fmt.Sprintf("%d.%06d", msec/1000, msec%1000*1000)
+}
+
+// mattermostMillis converts a Slack timestamp to msec.  The microseconds
+// are truncated.
+func mattermostMillis(ts string) (int64, error) {
+	parts := strings.SplitN(ts, ".", 2)
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	msec := sec * 1000
+	if len(parts) == 2 {
+		frac := (parts[1] + "000")[:3]
+		n, err := strconv.ParseInt(frac, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		msec += n
+	}
+	return msec, nil
+}
+
+// postTimestamp returns the timestamp of post id created at msec in ch.  The
+// microseconds are derived from the ID so that posts created in the same
+// millisecond have different timestamps; if they still collide, the next
+// free one is used.
+func (b *mattermostBackend) postTimestamp(ch string, msec int64, id string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ts, ok := b.timestamps[id]; ok {
+		return ts
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	usec := int64(h.Sum32() % 1000)
+	for i := int64(0); i < 1000; i++ {
+		ts := fmt.Sprintf("%d.%06d", msec/1000, msec%1000*1000+(usec+i)%1000)
+		if _, used := b.postIDs[ch+"/"+ts]; !used {
+			b.postIDs[ch+"/"+ts] = id
+			b.timestamps[id] = ts
+			return ts
+		}
+	}
+	return mattermostTimestamp(msec)
+}
+
+func (b *mattermostBackend) forget(ch, ts string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.timestamps, b.postIDs[ch+"/"+ts])
+	delete(b.postIDs, ch+"/"+ts)
+}
+
+func (b *mattermostBackend) message(p *mattermostPost) slack.Message {
+	ts := b.postTimestamp(p.ChannelID, p.CreateAt, p.ID)
+	msg := slack.Message{Msg: slack.Msg{
+		Channel:   p.ChannelID,
+		Timestamp: ts,
+		User:      p.UserID,
+		Text:      p.Message,
+		SubType:   p.Type,
+	}}
+	if fromBot, _ := p.Props["from_bot"].(string); fromBot == "true" {
+		msg.BotID = p.UserID
+	}
+	if p.EditAt > 0 {
+		msg.Edited = &slack.Edited{User: p.UserID, Timestamp: mattermostTimestamp(p.EditAt)}
+	}
+	for _, f := range p.Metadata.Files {
+		msg.Files = append(msg.Files, mattermostSlackFile(p.ChannelID, &f))
+	}
+	return msg
+}
+
+func mattermostSlackFile(ch string, f *mattermostFile) slack.File {
+	return slack.File{
+		ID:        f.ID,
+		Created:   slack.JSONTime(f.CreateAt / 1000),
+		Timestamp: slack.JSONTime(f.CreateAt / 1000),
+		Name:      f.Name,
+		Title:     f.Name,
+		Mimetype:  f.MimeType,
+		Filetype:  f.Extension,
+		User:      f.UserID,
+		Size:      f.Size,
+		Channels:  []string{ch},
+	}
+}
+
+// postID returns the ID of the post at ts in ch.  Posts not seen since
+// the start are searched for by create_at.
+func (b *mattermostBackend) postID(ch, ts string) (string, error) {
+	b.mu.Lock()
+	id, ok := b.postIDs[ch+"/"+ts]
+	b.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	msgs, err := b.History(ch, ts, ts)
+	if err != nil {
+		return "", err
+	}
+	for _, m := range msgs {
+		if m.Timestamp == ts {
+			b.mu.Lock()
+			id = b.postIDs[ch+"/"+ts]
+			b.mu.Unlock()
+			return id, nil
+		}
+	}
+	return "", errors.New("message_not_found")
+}
+
+func (b *mattermostBackend) DeleteMessage(ch, ts string) error {
+	id, err := b.postID(ch, ts)
+	if err != nil {
+		return err
+	}
+	err = b.call("DELETE", "/posts/"+id, nil, nil)
+	if isNotFound(err) {
+		return errors.New("message_not_found")
+	}
+	if err == nil {
+		b.forget(ch, ts)
+	}
+	return err
+}
+
+// DeleteFile fails since the API has no way to delete a file alone.
+// Detaching it from its post would leave it on the server.  Files are
+// deleted with their posts.
+func (b *mattermostBackend) DeleteFile(file *slack.File) error {
+	return errors.New("not_supported")
+}
+
+func (b *mattermostBackend) ListConversations() ([]slack.Channel, error) {
+	var teams []struct {
+		ID string `json:"id"`
+	}
+	if err := b.call("GET", "/users/me/teams", nil, &teams); err != nil {
+		return nil, fmt.Errorf("GetTeams: %w", err)
+	}
+	var channels []slack.Channel
+	for _, t := range teams {
+		var chs []mattermostChannel
+		if err := b.call("GET", "/users/me/teams/"+t.ID+"/channels", nil, &chs); err != nil {
+			return nil, fmt.Errorf("GetChannels(%s): %w", t.ID, err)
+		}
+		for _, c := range chs {
+			if c.DeleteAt > 0 || (c.Type != "O" && c.Type != "P") {
+				continue
+			}
+			ch := slack.Channel{}
+			ch.ID = c.ID
+			ch.Name = c.Name
+			ch.IsPrivate = c.Type == "P"
+			ch.IsMember = true
+			ch.Topic.Value = c.Header
+			ch.Purpose.Value = c.Purpose
+			channels = append(channels, ch)
+		}
+	}
+	return channels, nil
+}
+
+// History returns posts including thread replies, which are in channels in
+// Mattermost.
+func (b *mattermostBackend) History(ch, oldest, latest string) ([]slack.Message, error) {
+	from, to := int64(0), int64(math.MaxInt64)
+	var err error
+	if oldest != "" {
+		if from, err = mattermostMillis(oldest); err != nil {
+			return nil, err
+		}
+	}
+	if latest != "" {
+		if to, err = mattermostMillis(latest); err != nil {
+			return nil, err
+		}
+	}
+	var msgs []slack.Message
+	for page := 0; ; page++ {
+		var list mattermostPostList
+		path := fmt.Sprintf("/channels/%s/posts?page=%d&per_page=%d", ch, page, mattermostPerPage)
+		if err := b.call("GET", path, nil, &list); err != nil {
+			return nil, fmt.Errorf("GetPostsForChannel(%s): %w", ch, err)
+		}
+		for _, id := range list.Order {
+			p := list.Posts[id]
+			if p == nil || p.DeleteAt > 0 {
+				continue
+			}
+			if p.CreateAt > to {
+				continue
+			}
+			if p.CreateAt < from {
+				return msgs, nil
+			}
+			msgs = append(msgs, b.message(p))
+		}
+		if len(list.Order) < mattermostPerPage {
+			return msgs, nil
+		}
+	}
+}
+
+// ListFiles returns files attached to posts in the channels.
+func (b *mattermostBackend) ListFiles(from, to time.Time) ([]slack.File, error) {
+	channels, err := b.ListConversations()
+	if err != nil {
+		return nil, err
+	}
+	oldest, latest := "", ""
+	if !from.IsZero() {
+		oldest = slackTimestamp(from)
+	}
+	if !to.IsZero() {
+		latest = slackTimestamp(to.Add(time.Second))
+	}
+	var files []slack.File
+	for _, ch := range channels {
+		msgs, err := b.History(ch.ID, oldest, latest)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			files = append(files, m.Files...)
+		}
+	}
+	return files, nil
+}
+
+// Events connects to the WebSocket API and converts posted events to
+// *slack.MessageEvent and *slack.FileSharedEvent.  It reconnects with
+// backoff and sends connection events like RTM.
+func (b *mattermostBackend) Events() <-chan interface{} {
+	events := make(chan interface{})
+	go func() {
+		for count := 1; ; count++ {
+			conn := b.connect(events, count)
+			events <- &slack.ConnectedEvent{ConnectionCount: count}
+			stop := make(chan struct{})
+			go ping(conn, stop)
+			err := b.receive(conn, events)
+			close(stop)
+			conn.Close()
+			events <- &slack.DisconnectedEvent{Cause: err}
+		}
+	}()
+	return events
+}
+
+// connect connects to the WebSocket API, retrying with backoff.
+func (b *mattermostBackend) connect(events chan<- interface{}, count int) *websocket.Conn {
+	u, err := url.Parse(b.url + "/api/v4/websocket")
+	if err != nil {
+		fatal("Parse(%s) failed: %v", b.url, err)
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	header := http.Header{"Authorization": {"Bearer " + b.token}}
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		events <- &slack.ConnectingEvent{Attempt: attempt, ConnectionCount: count}
+		conn, resp, err := websocket.DefaultDialer.Dial(u.String(), header)
+		if err == nil {
+			return conn
+		}
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			events <- &slack.InvalidAuthEvent{}
+		}
+		events <- &slack.ConnectionErrorEvent{Attempt: attempt, Backoff: backoff, ErrorObj: err}
+		time.Sleep(backoff)
+		if backoff < 5*time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+// mattermostPostOf returns the post of a posted or post_edited event, which
+// is encoded as a JSON string.
+func mattermostPostOf(ev *mattermostEvent) (*mattermostPost, error) {
+	var s string
+	if err := json.Unmarshal(ev.Data["post"], &s); err != nil {
+		return nil, err
+	}
+	var p mattermostPost
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ping pings conn every mattermostPingInterval until stop is closed.  The
+// payload is the time to measure the latency.
+func ping(conn *websocket.Conn, stop <-chan struct{}) {
+	t := time.NewTicker(mattermostPingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-t.C:
+			data := []byte(strconv.FormatInt(now.UnixNano(), 10))
+			// a failure is noticed by receive
+			conn.WriteControl(websocket.PingMessage, data, now.Add(mattermostPingInterval))
+		}
+	}
+}
+
+// receive converts events from conn until an error occurs.  A frame which
+// can't be decoded is reported and skipped.  Pongs are sent as
+// *slack.LatencyReport.
+func (b *mattermostBackend) receive(conn *websocket.Conn, events chan<- interface{}) error {
+	conn.SetPongHandler(func(data string) error {
+		var latency time.Duration
+		if sent, err := strconv.ParseInt(data, 10, 64); err == nil {
+			latency = time.Since(time.Unix(0, sent))
+		}
+		events <- &slack.LatencyReport{Value: latency}
+		return nil
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var ev mattermostEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			events <- &slack.IncomingEventError{ErrorObj: fmt.Errorf("Unmarshal(event): %w", err)}
+			continue
+		}
+		if ev.Event != "posted" && ev.Event != "post_edited" {
+			continue
+		}
+		p, err := mattermostPostOf(&ev)
+		if err != nil {
+			events <- &slack.IncomingEventError{ErrorObj: fmt.Errorf("Unmarshal(%s): %w", ev.Event, err)}
+			continue
+		}
+		msg := b.message(p)
+		if ev.Event == "post_edited" {
+			events <- &slack.MessageEvent{
+				Msg:        slack.Msg{Channel: p.ChannelID, SubType: "message_changed"},
+				SubMessage: &msg.Msg,
+			}
+			continue
+		}
+		events <- (*slack.MessageEvent)(&msg)
+		for i := range msg.Files {
+			events <- &slack.FileSharedEvent{FileID: msg.Files[i].ID, File: msg.Files[i]}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package blackhole
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/slack-go/slack"
+)
+
+// newMattermostServer returns a server with posts in channel "ch1" whose
+// create_at are 3000, 2000 and 1000 msec.
+func newMattermostServer(t *testing.T, deleted *[]string) *httptest.Server {
+	posts := mattermostPostList{
+		Order: []string{"p3", "p2", "p1"},
+		Posts: map[string]*mattermostPost{
+			"p3": {ID: "p3", ChannelID: "ch1", CreateAt: 3000, Message: "third"},
+			"p2": {ID: "p2", ChannelID: "ch1", CreateAt: 2000, Message: "second"},
+			"p1": {ID: "p1", ChannelID: "ch1", CreateAt: 1000, Message: "first"},
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/channels/ch1/posts", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") != "0" {
+			json.NewEncoder(w).Encode(mattermostPostList{})
+			return
+		}
+		json.NewEncoder(w).Encode(posts)
+	})
+	mux.HandleFunc("/api/v4/posts/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		}
+		*deleted = append(*deleted, r.URL.Path)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestMattermostHistory(t *testing.T) {
+	var deleted []string
+	s := newMattermostServer(t, &deleted)
+	defer s.Close()
+	b := newMattermostBackend(s.URL, "", s.Client())
+
+	msgs, err := b.History("ch1", "", "")
+	if err != nil {
+		t.Fatalf("History() failed: %v", err)
+	}
+	if len(msgs) != 3 || !strings.HasPrefix(msgs[0].Timestamp, "3.000") || !strings.HasPrefix(msgs[2].Timestamp, "1.000") {
+		t.Errorf("History() = %v, want 3 messages from newest to oldest", msgs)
+	}
+
+	msgs, err = b.History("ch1", "2.000999", "2.000999")
+	if err != nil {
+		t.Fatalf("History() failed: %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].Text != "second" {
+		t.Errorf("History(2.000000, 2.000000) = %v, want the second post", msgs)
+	}
+}
+
+func TestMattermostDeleteMessage(t *testing.T) {
+	var deleted []string
+	s := newMattermostServer(t, &deleted)
+	defer s.Close()
+	b := newMattermostBackend(s.URL, "", s.Client())
+
+	// the post is looked up by the timestamp
+	ts := newMattermostBackend("", "", nil).postTimestamp("ch1", 2000, "p2")
+	if err := b.DeleteMessage("ch1", ts); err != nil {
+		t.Fatalf("DeleteMessage() failed: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0] != "/api/v4/posts/p2" {
+		t.Errorf("deleted %v, want [/api/v4/posts/p2]", deleted)
+	}
+	if err := b.DeleteMessage("ch1", "1.500500"); err == nil || err.Error() != "message_not_found" {
+		t.Errorf("DeleteMessage() of a missing post returned %v, want message_not_found", err)
+	}
+}
+
+func TestMattermostPostsInSameMillisecond(t *testing.T) {
+	b := newMattermostBackend("", "", nil)
+	ts1 := b.postTimestamp("ch1", 1000, "p1")
+	ts2 := b.postTimestamp("ch1", 1000, "p2")
+	if ts1 == ts2 {
+		t.Errorf("posts in the same millisecond have the same timestamp %s", ts1)
+	}
+	if ts := b.postTimestamp("ch1", 1000, "p1"); ts != ts1 {
+		t.Errorf("timestamp of p1 changed from %s to %s", ts1, ts)
+	}
+	if msec, err := mattermostMillis(ts2); err != nil || msec != 1000 {
+		t.Errorf("mattermostMillis(%s) = %d, %v, want 1000", ts2, msec, err)
+	}
+}
+
+func TestMattermostReceive(t *testing.T) {
+	frames := []string{
+		`{"event":"hello","data":{"server_version":"9.5.0"},"broadcast":{},"seq":0}`,
+		`{"event":"config_changed","data":{"config":{"EnableCustomEmoji":"true"}},"broadcast":{},"seq":1}`,
+		`{"event":"posted","data":{"channel_display_name":"Town Square","channel_name":"town-square","channel_type":"O",` +
+			`"mentions":"[\"u2\"]","post":"{\"id\":\"p9\",\"create_at\":5000,\"user_id\":\"u1\",\"channel_id\":\"ch1\",\"message\":\"hi\"}",` +
+			`"sender_name":"@alice","set_online":true,"team_id":"t1"},"broadcast":{"channel_id":"ch1"},"seq":2}`,
+	}
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		for _, f := range frames {
+			conn.WriteMessage(websocket.TextMessage, []byte(f))
+		}
+	}))
+	defer s.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	b := newMattermostBackend(s.URL, "", nil)
+	events := make(chan interface{}, 10)
+	if err := b.receive(conn, events); err == nil {
+		t.Errorf("receive() returned no error on close")
+	}
+	close(events)
+	var got []*slack.MessageEvent
+	for ev := range events {
+		switch ev := ev.(type) {
+		case *slack.MessageEvent:
+			got = append(got, ev)
+		case *slack.IncomingEventError:
+			t.Errorf("unexpected error: %v", ev.ErrorObj)
+		}
+	}
+	if len(got) != 1 || got[0].Channel != "ch1" || got[0].Text != "hi" {
+		t.Fatalf("receive() sent %+v, want the post p9", got)
+	}
+}
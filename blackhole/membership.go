@@ -0,0 +1,96 @@
+package blackhole
+
+import (
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+var (
+	// MEMBERSHIP records whether the token is a member of each channel.
+	// It is updated on sweeps and by join/leave events.
+	MEMBERSHIP      = make(map[string]bool)
+	MEMBERSHIP_LOCK sync.Mutex
+
+	// UNENFORCEABLE has channels already reported as unenforceable, so
+	// that they are not reported on every sweep.
+	UNENFORCEABLE = make(map[string]bool)
+)
+
+func setMembership(ch string, member bool) {
+	MEMBERSHIP_LOCK.Lock()
+	defer MEMBERSHIP_LOCK.Unlock()
+	MEMBERSHIP[ch] = member
+	if member {
+		delete(UNENFORCEABLE, ch)
+	}
+}
+
+// isMember returns whether the token is a member of ch.  Unknown channels
+// are regarded as joined.
+func isMember(ch string) bool {
+	MEMBERSHIP_LOCK.Lock()
+	defer MEMBERSHIP_LOCK.Unlock()
+	member, ok := MEMBERSHIP[ch]
+	return member || !ok
+}
+
+// ensureMembership returns true if the policy can be enforced in ch.  Bots
+// can't read nor delete messages in channels they are not a member of.  If
+// join is true and --auto-join is set, public channels are joined.
+func ensureMembership(ch slack.Channel, join bool) bool {
+	setMembership(ch.ID, ch.IsMember)
+	if !SELF_IS_BOT || ch.IsMember {
+		return true
+	}
+	fields := logFields{Action: "membership", Channel: ch.ID}
+	if join && AUTO_JOIN && !ch.IsPrivate {
+		waitAPI("conversations.join")
+		_, _, _, err := RTM.JoinConversation(ch.ID)
+		if err == nil {
+			fields.info("Joined #%s(%s) to enforce the policy", ch.Name, ch.ID)
+			setMembership(ch.ID, true)
+			return true
+		}
+		fields.errorlog("JoinConversation(%s) failed: %v", ch.ID, err)
+	}
+
+	MEMBERSHIP_LOCK.Lock()
+	reported := UNENFORCEABLE[ch.ID]
+	UNENFORCEABLE[ch.ID] = true
+	MEMBERSHIP_LOCK.Unlock()
+	if !reported {
+		hint := "invite the bot"
+		if !ch.IsPrivate {
+			hint += " or set --auto-join"
+		}
+		fields.errorlog("The policy of #%s(%s) cannot be enforced because the bot is not a member; %s", ch.Name, ch.ID, hint)
+	}
+	return false
+}
+
+// handleMembershipEvent handles events on the membership of the token and
+// returns true if ev is one of them.
+func handleMembershipEvent(ev interface{}) bool {
+	switch ev := ev.(type) {
+	case *slack.ChannelJoinedEvent:
+		setMembership(ev.Channel.ID, true)
+	case *slack.GroupJoinedEvent:
+		setMembership(ev.Channel.ID, true)
+	case *slack.ChannelLeftEvent:
+		setMembership(ev.Channel, false)
+	case *slack.GroupLeftEvent:
+		setMembership(ev.Channel, false)
+	case *slack.MemberJoinedChannelEvent:
+		if ev.User == SELF_USER_ID {
+			setMembership(ev.Channel, true)
+		}
+	case *slack.MemberLeftChannelEvent:
+		if ev.User == SELF_USER_ID {
+			setMembership(ev.Channel, false)
+		}
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package blackhole
+
+import (
+	"github.com/slack-go/slack"
+)
+
+func deleteFilesWithMessage(ch string) bool {
+	cfg := channelConfig(ch)
+	if cfg.DeleteFilesWithMessage != nil {
+		return *cfg.DeleteFilesWithMessage
+	}
+	return DELETE_FILES_WITH_MESSAGE
+}
+
+// deleteMessageFiles deletes files attached to msg, which has just been
+// deleted.  Files shared to other channels are not deleted.
+func deleteMessageFiles(ch string, msg *slack.Message) {
+	if len(msg.Files) == 0 || !deleteFilesWithMessage(ch) {
+		return
+	}
+	// files in Mattermost are deleted with the post
+	if !slackOnly("delete_files_with_message", messageLog("delete_with_message", ch, msg.Timestamp)) {
+		return
+	}
+	for i := range msg.Files {
+		id := msg.Files[i].ID
+		waitAPI("files.info")
+		f, _, _, err := RTM.GetFileInfo(id, 0, 1)
+		if err != nil {
+			if err.Error() != "file_not_found" && err.Error() != "file_deleted" {
+				fileLog("delete_with_message", id).errorlog("GetFileInfo for %s failed: %v", id, err)
+			}
+			continue
+		}
+		if len(f.Channels) != 1 || f.Channels[0] != ch {
+			fileLog("skip", id).info("File %s in message %s(%s) will not be deleted because of channel: %v", id, ch, msg.Timestamp, f.Channels)
+			continue
+		}
+		fileLog("delete_with_message", id).info("File %s will be deleted with message %s(%s)", id, ch, msg.Timestamp)
+		deleteFile(ch, f, 0)
+	}
+}
@@ -0,0 +1,43 @@
+package blackhole
+
+import (
+	"fmt"
+	"time"
+)
+
+// checkMinTTL returns an error if ttl (sec) named name is negative, or is
+// shorter than --min-ttl unless --allow-short-ttl is set.  0 means no TTL and
+// is allowed.
+func checkMinTTL(name string, ttl int) error {
+	if ttl < 0 {
+		return fmt.Errorf("%s %d must not be negative", name, ttl)
+	}
+	if ALLOW_SHORT_TTL || ttl == 0 || time.Duration(ttl)*time.Second >= MIN_TTL {
+		return nil
+	}
+	return fmt.Errorf("%s %s is shorter than --min-ttl %s (set --allow-short-ttl to allow it)", name, formatTTL(ttl), MIN_TTL)
+}
+
+// checkMinTTLs checks TTLs given by admins.  nil is allowed.
+func checkMinTTLs(messageTTL, fileTTL *int) error {
+	if messageTTL != nil {
+		if err := checkMinTTL("message TTL", *messageTTL); err != nil {
+			return err
+		}
+	}
+	if fileTTL != nil {
+		if err := checkMinTTL("file TTL", *fileTTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func initMinTTL() {
+	if err := checkMinTTL("--default-message-ttl", DEFAULT_MESSAGE_TTL); err != nil {
+		fatal("%v", err)
+	}
+	if err := checkMinTTL("--default-file-ttl", DEFAULT_FILE_TTL); err != nil {
+		fatal("%v", err)
+	}
+}
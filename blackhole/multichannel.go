@@ -0,0 +1,99 @@
+package blackhole
+
+import (
+	"github.com/slack-go/slack"
+)
+
+func fileTTL(ch string) int {
+	cfg := channelConfig(ch)
+	return cfg.calendarTTL(directiveTTL(ch, cfg.FileTTL, DEFAULT_FILE_TTL))
+}
+
+func initMultiChannelFilePolicy() {
+	switch MULTI_CHANNEL_FILE_POLICY {
+	case "skip", "strictest", "longest", "unshare":
+	default:
+		fatal("Unknown multi-channel file policy: %s", MULTI_CHANNEL_FILE_POLICY)
+	}
+}
+
+// handleMultiChannelFile handles a file shared to multiple channels
+// according to MULTI_CHANNEL_FILE_POLICY.
+func handleMultiChannelFile(file *slack.File) {
+	fields := fileLog("multi_channel", file.ID)
+	for _, ch := range file.Channels {
+		if !POLICY.Managed(ch) && MULTI_CHANNEL_FILE_POLICY != "skip" {
+			fields.info("File %s will not be deleted because channel %s is not managed", file.ID, ch)
+			return
+		}
+	}
+	switch MULTI_CHANNEL_FILE_POLICY {
+	case "strictest":
+		ch, ttl := "", 0
+		for _, c := range file.Channels {
+			t := POLICY.FileTTL(c)
+			if t > 0 && (ttl == 0 || t < ttl) {
+				ch, ttl = c, t
+			}
+		}
+		if ttl > 0 {
+			fields.debug("File %s in %v uses the shortest TTL %d of %s", file.ID, file.Channels, ttl, ch)
+			deleteFile(ch, file, ttl)
+		}
+	case "longest":
+		ch, ttl := longestFileTTL(file)
+		if ttl > 0 {
+			fields.debug("File %s in %v uses the longest TTL %d of %s", file.ID, file.Channels, ttl, ch)
+			deleteFile(ch, file, ttl)
+		}
+	case "unshare":
+		unshareFile(file)
+	default:
+		// file shared to multi channel is not supposed to be deleted
+		fileLog("skip", file.ID).info("File %s will not be deleted because of channel: %v", file.ID, file.Channels)
+	}
+}
+
+// longestFileTTL returns the channel having the longest file TTL among the
+// channels which file is shared to and the TTL.  The TTL is 0 if any of the
+// channels has no file TTL.
+func longestFileTTL(file *slack.File) (string, int) {
+	ch, ttl := "", 0
+	for _, c := range file.Channels {
+		t := POLICY.FileTTL(c)
+		if t == 0 {
+			return c, 0
+		}
+		if t > ttl {
+			ch, ttl = c, t
+		}
+	}
+	return ch, ttl
+}
+
+// unshareFile schedules deletion of the messages sharing file in each
+// channel when the file expires in the channel.  The file itself is deleted
+// when it expires in all the channels.
+func unshareFile(file *slack.File) {
+	longestCh, longestTTL := longestFileTTL(file)
+	for _, ch := range file.Channels {
+		ttl := POLICY.FileTTL(ch)
+		if ttl == 0 || (longestTTL > 0 && ch == longestCh) {
+			continue
+		}
+		shares := file.Shares.Public[ch]
+		if len(shares) == 0 {
+			shares = file.Shares.Private[ch]
+		}
+		for _, share := range shares {
+			fileLog("unshare", file.ID).info("File %s will be unshared from %s by deleting message %s", file.ID, ch, share.Ts)
+			deleteMessage(ch, &slack.Message{Msg: slack.Msg{
+				Timestamp:       share.Ts,
+				ThreadTimestamp: share.ThreadTs,
+			}}, ttl)
+		}
+	}
+	if longestTTL > 0 {
+		deleteFile(longestCh, file, longestTTL)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package blackhole
+
+import (
+	"time"
+)
+
+// sdNotify is a no-op where systemd is not available.
+func sdNotify(state string) {}
+
+func watchdogInterval() time.Duration {
+	return 0
+}
@@ -0,0 +1,21 @@
+package blackhole
+
+import (
+	"math/rand"
+	"time"
+)
+
+// paceBacklog returns the time to delete an item which is due at tbd.  An
+// item already expired when it is scheduled, which is found by sweeps, is
+// backlog and is deferred to a random time within --backlog-spread so that
+// a large backlog doesn't contend with real-time expirations for the API.
+func paceBacklog(tbd time.Time) (time.Time, bool) {
+	now := time.Now()
+	if tbd.After(now) {
+		return tbd, false
+	}
+	if BACKLOG_SPREAD <= 0 {
+		return tbd, true
+	}
+	return now.Add(time.Duration(rand.Int63n(int64(BACKLOG_SPREAD)))), true
+}
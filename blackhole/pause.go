@@ -0,0 +1,86 @@
+package blackhole
+
+import (
+	"sync"
+)
+
+// Reasons of pauses.
+const (
+	// pauseByAdmin is a pause by the admin command, the admin API or the
+	// TUI.
+	pauseByAdmin = "admin"
+	// pauseByArchive is a pause on archiving the channel.
+	pauseByArchive = "archive"
+)
+
+var (
+	// PAUSED has a channel for each paused Slack channel, which is closed
+	// when the Slack channel is resumed.  PAUSE_REASONS has why it is
+	// paused.
+	PAUSED        = make(map[string]chan struct{})
+	PAUSE_REASONS = make(map[string]string)
+	PAUSED_LOCK   sync.Mutex
+)
+
+// pauseChannel suspends deletions in ch by the admin.  It returns false if
+// ch is already paused.
+func pauseChannel(ch string) bool {
+	return pauseChannelBy(ch, pauseByAdmin)
+}
+
+// pauseChannelBy suspends deletions in ch for reason.  It returns false if ch
+// is already paused.  A pause by the admin takes over one by archiving so
+// that unarchiving doesn't resume the channel.
+func pauseChannelBy(ch, reason string) bool {
+	PAUSED_LOCK.Lock()
+	defer PAUSED_LOCK.Unlock()
+	if _, ok := PAUSED[ch]; ok {
+		if reason == pauseByAdmin {
+			PAUSE_REASONS[ch] = reason
+		}
+		return false
+	}
+	PAUSED[ch] = make(chan struct{})
+	PAUSE_REASONS[ch] = reason
+	logFields{Action: "pause", Channel: ch}.info("Channel %s is paused (%s)", ch, reason)
+	return true
+}
+
+// resumeChannel resumes deletions in ch whatever paused it.  Deletions which
+// came due while paused are executed.  It returns false if ch is not paused.
+func resumeChannel(ch string) bool {
+	return resumeChannelBy(ch, "")
+}
+
+// resumeChannelBy is resumeChannel which resumes ch only if it is paused
+// for reason.  reason "" means any reason.
+func resumeChannelBy(ch, reason string) bool {
+	PAUSED_LOCK.Lock()
+	defer PAUSED_LOCK.Unlock()
+	c, ok := PAUSED[ch]
+	if !ok || reason != "" && PAUSE_REASONS[ch] != reason {
+		return false
+	}
+	close(c)
+	delete(PAUSED, ch)
+	delete(PAUSE_REASONS, ch)
+	logFields{Action: "resume", Channel: ch}.info("Channel %s is resumed", ch)
+	return true
+}
+
+func isPaused(ch string) bool {
+	PAUSED_LOCK.Lock()
+	defer PAUSED_LOCK.Unlock()
+	_, ok := PAUSED[ch]
+	return ok
+}
+
+// waitResumed blocks while ch is paused.
+func waitResumed(ch string) {
+	PAUSED_LOCK.Lock()
+	c, ok := PAUSED[ch]
+	PAUSED_LOCK.Unlock()
+	if ok {
+		<-c
+	}
+}
@@ -0,0 +1,223 @@
+package blackhole
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// pendingItem is a scheduled deletion of a message or a file.
+type pendingItem struct {
+	ID      uint64    `json:"id"`
+	Kind    string    `json:"kind"`
+	Channel string    `json:"channel"`
+	TS      string    `json:"ts,omitempty"`
+	File    string    `json:"file,omitempty"`
+	DueAt   time.Time `json:"due_at"`
+	State   string    `json:"state"`
+
+	// Backlog is true if the item was already expired when it was
+	// scheduled.  Backlog is deleted after real-time expirations.
+	Backlog bool `json:"backlog,omitempty"`
+
+	// earlier is notified when DueAt is moved earlier.
+	earlier chan struct{}
+
+	// canceled is closed when the deletion is canceled.
+	canceled chan struct{}
+
+	// dueChanged is notified when DueAt is changed, and ended is closed
+	// when the item is done or canceled.  They are for the expiry preview.
+	dueChanged chan struct{}
+	ended      chan struct{}
+
+	// trace is the span of the whole deletion and phase is the span of
+	// the current state in it.
+	trace *span
+	phase *span
+}
+
+var (
+	PENDING = make(map[uint64]*pendingItem)
+
+	// PENDING_INDEX is PENDING keyed by pendingKey so that an item seen
+	// by both an event and a sweep is scheduled only once.
+	PENDING_INDEX = make(map[string]*pendingItem)
+	PENDING_LOCK  sync.Mutex
+	pendingSeq    uint64
+)
+
+// pendingKey identifies the deletion of a message by the channel and the
+// timestamp, and that of a file by the ID.
+func pendingKey(kind, ch, ts, file string) string {
+	if kind == "message" {
+		return kind + "/" + ch + "/" + ts
+	}
+	return kind + "/" + file
+}
+
+// addPending adds the scheduled deletion of an item.  If the item is
+// already scheduled, it returns the existing one and false.  The existing
+// one is moved to dueAt if it is earlier, e.g. max_messages is exceeded.
+func addPending(kind, ch, ts, file string, dueAt time.Time, backlog bool) (*pendingItem, bool) {
+	PENDING_LOCK.Lock()
+	defer PENDING_LOCK.Unlock()
+	key := pendingKey(kind, ch, ts, file)
+	if p, ok := PENDING_INDEX[key]; ok {
+		if p.State == "waiting" && dueAt.Before(p.DueAt) {
+			p.DueAt = dueAt
+			select {
+			case p.earlier <- struct{}{}:
+			default:
+			}
+			p.notifyDueChanged()
+		}
+		return p, false
+	}
+	pendingSeq++
+	p := &pendingItem{
+		ID:         pendingSeq,
+		Kind:       kind,
+		Channel:    ch,
+		TS:         ts,
+		File:       file,
+		DueAt:      dueAt,
+		State:      "waiting",
+		Backlog:    backlog,
+		earlier:    make(chan struct{}, 1),
+		canceled:   make(chan struct{}),
+		dueChanged: make(chan struct{}, 1),
+		ended:      make(chan struct{}),
+	}
+	p.trace = startSpan(kind+"_deletion", nil, "channel", ch, "ts", ts, "file", file)
+	p.phase = startSpan("waiting", p.trace)
+	PENDING[p.ID] = p
+	PENDING_INDEX[key] = p
+	return p, true
+}
+
+func (p *pendingItem) setState(state string) {
+	PENDING_LOCK.Lock()
+	defer PENDING_LOCK.Unlock()
+	p.State = state
+	p.phase.end()
+	p.phase = startSpan(state, p.trace)
+}
+
+// setError records err of the API call in the trace.  If final is true,
+// the whole deletion is marked as failed.
+func (p *pendingItem) setError(err error, final bool) {
+	PENDING_LOCK.Lock()
+	defer PENDING_LOCK.Unlock()
+	p.phase.setError(err)
+	if final {
+		p.trace.setError(err)
+	}
+}
+
+func (p *pendingItem) setDueAt(dueAt time.Time) {
+	PENDING_LOCK.Lock()
+	defer PENDING_LOCK.Unlock()
+	p.DueAt = dueAt
+	p.notifyDueChanged()
+}
+
+// notifyDueChanged notifies dueChanged.  It requires PENDING_LOCK to be held.
+func (p *pendingItem) notifyDueChanged() {
+	select {
+	case p.dueChanged <- struct{}{}:
+	default:
+	}
+}
+
+// end closes ended.  It requires PENDING_LOCK to be held.
+func (p *pendingItem) end() {
+	select {
+	case <-p.ended:
+	default:
+		close(p.ended)
+	}
+}
+
+// status returns DueAt and State of p.
+func (p *pendingItem) status() (time.Time, string) {
+	PENDING_LOCK.Lock()
+	defer PENDING_LOCK.Unlock()
+	return p.DueAt, p.State
+}
+
+// waitDue waits until DueAt, which may be moved earlier while waiting.  It
+// returns false if the deletion is canceled.
+func (p *pendingItem) waitDue() bool {
+	for {
+		PENDING_LOCK.Lock()
+		dueAt := p.DueAt
+		PENDING_LOCK.Unlock()
+		select {
+		case <-time.After(dueAt.Sub(time.Now())):
+			return !p.isCanceled()
+		case <-p.earlier:
+		case <-p.canceled:
+			return false
+		}
+	}
+}
+
+func (p *pendingItem) isCanceled() bool {
+	select {
+	case <-p.canceled:
+		return true
+	default:
+		return false
+	}
+}
+
+// cancelPending cancels the scheduled deletion of an item and removes it
+// from the pending items.  It returns false if the item is not pending or
+// is already submitted to the deletion workers.
+func cancelPending(kind, ch, ts, file string) bool {
+	PENDING_LOCK.Lock()
+	defer PENDING_LOCK.Unlock()
+	key := pendingKey(kind, ch, ts, file)
+	p, ok := PENDING_INDEX[key]
+	if !ok || p.State == "queued" || p.State == "deleting" {
+		return false
+	}
+	p.State = "canceled"
+	close(p.canceled)
+	p.end()
+	delete(PENDING, p.ID)
+	delete(PENDING_INDEX, key)
+	p.phase.end()
+	p.trace.end()
+	return true
+}
+
+func (p *pendingItem) done() {
+	PENDING_LOCK.Lock()
+	defer PENDING_LOCK.Unlock()
+	delete(PENDING, p.ID)
+	if key := pendingKey(p.Kind, p.Channel, p.TS, p.File); PENDING_INDEX[key] == p {
+		delete(PENDING_INDEX, key)
+	}
+	p.end()
+	p.phase.end()
+	p.trace.end()
+}
+
+// pendingItems returns copies of the pending items sorted by due time.
+func pendingItems() []pendingItem {
+	PENDING_LOCK.Lock()
+	items := make([]pendingItem, 0, len(PENDING))
+	for _, p := range PENDING {
+		items = append(items, *p)
+	}
+	PENDING_LOCK.Unlock()
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].DueAt.Equal(items[j].DueAt) {
+			return items[i].ID < items[j].ID
+		}
+		return items[i].DueAt.Before(items[j].DueAt)
+	})
+	return items
+}
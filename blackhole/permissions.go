@@ -0,0 +1,121 @@
+package blackhole
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// capability is a feature and the OAuth scopes it requires.  Each element
+// of scopes is a list of alternatives; any of them satisfies it.
+type capability struct {
+	feature string
+	scopes  [][]string
+}
+
+var capabilities = []capability{
+	{"List channels", [][]string{{"channels:read"}}},
+	{"Read channel history", [][]string{{"channels:history"}}},
+	{"Delete messages", [][]string{{"chat:write", "chat:write:user", "chat:write:bot"}}},
+	{"List files", [][]string{{"files:read"}}},
+	{"Delete files", [][]string{{"files:write", "files:write:user"}}},
+	{"Private channels", [][]string{{"groups:read"}, {"groups:history"}}},
+	{"Warn with reactions", [][]string{{"reactions:write"}}},
+	{"Admin commands", [][]string{{"users:read"}, {"im:history"}}},
+	{"Join channels (--auto-join)", [][]string{{"channels:join"}}},
+	{"Canvases and bookmarks", [][]string{{"canvases:write"}, {"bookmarks:read"}, {"bookmarks:write"}}},
+}
+
+// grantedScopes returns the OAuth scopes granted to the token, which are
+// returned in X-OAuth-Scopes header of API responses.
+func grantedScopes() ([]string, error) {
+	req, err := http.NewRequest(http.MethodPost, slack.APIURL+"auth.test", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+SLACK_API_TOKEN)
+	client := &http.Client{Timeout: 10 * time.Second}
+	waitAPI("auth.test")
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	h := res.Header.Get("X-OAuth-Scopes")
+	if h == "" {
+		return nil, fmt.Errorf("no X-OAuth-Scopes header")
+	}
+	var scopes []string
+	for _, s := range strings.Split(h, ",") {
+		scopes = append(scopes, strings.TrimSpace(s))
+	}
+	return scopes, nil
+}
+
+// missingScopes returns the scopes required by c but not granted.
+func (c *capability) missingScopes(granted map[string]bool) []string {
+	var missing []string
+	for _, alts := range c.scopes {
+		ok := false
+		for _, s := range alts {
+			if granted[s] {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			missing = append(missing, strings.Join(alts, " or "))
+		}
+	}
+	return missing
+}
+
+// checkPermissions reports which features work with the token.
+func checkPermissions(at *slack.AuthTestResponse) {
+	fields := logFields{Action: "self_check"}
+	scopes, err := grantedScopes()
+	if err != nil {
+		fields.info("Cannot get the scopes of the token, skipping the permission check: %v", err)
+		return
+	}
+	fields.info("Granted scopes: %s", strings.Join(scopes, ","))
+	granted := make(map[string]bool)
+	for _, s := range scopes {
+		granted[s] = true
+	}
+	if granted["client"] {
+		// legacy full-access token
+		fields.info("The token has the legacy client scope; all features are available")
+	} else {
+		for i := range capabilities {
+			c := &capabilities[i]
+			if missing := c.missingScopes(granted); len(missing) > 0 {
+				fields.errorlog("%s: NOT available (missing scope: %s)", c.feature, strings.Join(missing, ", "))
+			} else {
+				fields.info("%s: OK", c.feature)
+			}
+		}
+	}
+
+	switch {
+	case USER_CLIENT != nil:
+		fields.info("Deletions use the user token; messages of other users can be deleted if it belongs to an admin")
+	case at.BotID != "" || strings.HasPrefix(SLACK_API_TOKEN, "xoxb-"):
+		fields.errorlog("The token is a bot token; messages of other users cannot be deleted")
+	default:
+		waitAPI("users.info")
+		u, err := RTM.GetUserInfo(at.UserID)
+		if err != nil {
+			fields.info("Cannot get the user of the token: %v", err)
+			return
+		}
+		if u.IsAdmin || u.IsOwner || u.IsPrimaryOwner {
+			fields.info("The token belongs to an admin; messages of other users can be deleted")
+		} else {
+			fields.errorlog("The token does not belong to an admin; messages of other users cannot be deleted")
+		}
+	}
+}
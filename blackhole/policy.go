@@ -0,0 +1,67 @@
+package blackhole
+
+import (
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// EXCLUDED has IDs of channels in --exclude-channels
+var EXCLUDED = make(map[string]bool)
+
+func initPolicyMode() {
+	switch POLICY_MODE {
+	case "allowlist", "denylist":
+	default:
+		fatal("Unknown policy mode: %s", POLICY_MODE)
+	}
+	info("Policy mode: %s", POLICY_MODE)
+}
+
+func initExcludeChannels() {
+	if EXCLUDE_CHANNELS == "" {
+		return
+	}
+	channels, err := BACKEND.ListConversations()
+	if err != nil {
+		fatal("getting the list of channels failed: %v", err)
+	}
+	excludeChannels(channels)
+}
+
+// excludeChannels marks channels in EXCLUDE_CHANNELS as excluded.
+func excludeChannels(channels []slack.Channel) {
+	for _, name := range strings.Split(EXCLUDE_CHANNELS, ",") {
+		name = strings.TrimPrefix(strings.TrimSpace(name), "#")
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, ch := range channels {
+			if ch.Name == name || ch.ID == name {
+				EXCLUDED[ch.ID] = true
+				found = true
+				info("Channel %s(%s) is excluded", ch.Name, ch.ID)
+			}
+		}
+		if !found {
+			errorlog("Excluded channel %s is not found", name)
+		}
+	}
+}
+
+// managed returns true if messages and files in ch may be deleted.  Channels
+// in --exclude-channels are never managed.  In allowlist mode, only channels
+// in the config are managed.
+func managed(ch string) bool {
+	if EXCLUDED[ch] {
+		return false
+	}
+	if POLICY_MODE == "allowlist" {
+		CONFIG_LOCK.RLock()
+		defer CONFIG_LOCK.RUnlock()
+		_, ok := CONFIG_BY_ID[ch]
+		return ok
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+package blackhole
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// previewFreshness is how old a message can be to get the note of
+// expiry_preview "note".  Older messages found by sweeps don't get it.
+const previewFreshness = time.Hour
+
+// dayReactions are the reactions of expiry_preview "reaction" for 1-10 days
+// left.
+var dayReactions = []string{"one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "keycap_ten"}
+
+var (
+	// PREVIEWED has messages which have got the expiry preview.
+	PREVIEWED      = make(map[string]bool)
+	PREVIEWED_LOCK sync.Mutex
+)
+
+// daysLeft returns the number of days until tbd rounded up.
+func daysLeft(tbd, now time.Time) int {
+	return int((tbd.Sub(now) + 24*time.Hour - 1) / (24 * time.Hour))
+}
+
+// dayReaction returns the reaction for days left: a number up to 10 days
+// and :calendar: for more.
+func dayReaction(days int) string {
+	if days > len(dayReactions) {
+		return "calendar"
+	}
+	return dayReactions[days-1]
+}
+
+func forgetExpiryPreview(ch, ts string) {
+	PREVIEWED_LOCK.Lock()
+	defer PREVIEWED_LOCK.Unlock()
+	delete(PREVIEWED, ch+"/"+ts)
+}
+
+// startExpiryPreview annotates msg with when it will be deleted by p
+// according to expiry_preview of ch.  It does nothing if msg already has
+// it.
+func startExpiryPreview(ch string, msg *slack.Message, p *pendingItem) {
+	tbd, _ := p.status()
+	mode := channelConfig(ch).ExpiryPreview
+	if mode == "" || !tbd.After(time.Now()) {
+		return
+	}
+	fields := messageLog("preview", ch, msg.Timestamp)
+	if !slackOnly("expiry_preview", fields) {
+		return
+	}
+	key := ch + "/" + msg.Timestamp
+	PREVIEWED_LOCK.Lock()
+	done := PREVIEWED[key]
+	PREVIEWED[key] = true
+	PREVIEWED_LOCK.Unlock()
+	if done {
+		return
+	}
+	switch mode {
+	case "reaction":
+		go refreshExpiryReaction(ch, msg, p)
+	case "note":
+		posted, err := unixTime(msg.Timestamp)
+		if err != nil || time.Since(posted) > previewFreshness {
+			return
+		}
+		go postExpiryNote(ch, msg, tbd)
+	}
+}
+
+// refreshExpiryReaction keeps the reaction of msg showing the days left
+// until the deletion by p, and updates it daily or when the deletion is
+// postponed.  The reaction is removed if msg is kept, protected or otherwise
+// not deleted.  The reaction for one more day is removed first in case it
+// was added before a restart.
+func refreshExpiryReaction(ch string, msg *slack.Message, p *pendingItem) {
+	fields := messageLog("preview", ch, msg.Timestamp)
+	ref := slack.NewRefToMessage(ch, msg.Timestamp)
+	add := func(reaction string) {
+		if DRY_RUN {
+			fields.info("Add :%s: to message %s(%s) (dry-run)", reaction, ch, msg.Timestamp)
+			return
+		}
+		waitAPI("reactions.add")
+		err := RTM.AddReaction(reaction, ref)
+		if err != nil && err.Error() != "already_reacted" {
+			fields.errorlog("AddReaction(%s, %s, %s) failed: %v", reaction, ch, msg.Timestamp, err)
+		}
+	}
+	remove := func(reaction string) {
+		if DRY_RUN {
+			return
+		}
+		waitAPI("reactions.remove")
+		err := RTM.RemoveReaction(reaction, ref)
+		if err != nil && err.Error() != "no_reaction" {
+			fields.errorlog("RemoveReaction(%s, %s, %s) failed: %v", reaction, ch, msg.Timestamp, err)
+		}
+	}
+
+	shown := ""
+	for {
+		tbd, _ := p.status()
+		now := time.Now()
+		var tick <-chan time.Time
+		if tbd.After(now) {
+			days := daysLeft(tbd, now)
+			reaction := dayReaction(days)
+			if reaction != shown {
+				add(reaction)
+				old := shown
+				if old == "" {
+					old = dayReaction(days + 1)
+				}
+				if old != reaction {
+					remove(old)
+				}
+				shown = reaction
+			}
+			// the next change is when the days left decrease
+			next := tbd.Add(-time.Duration(days-1) * 24 * time.Hour)
+			if days > len(dayReactions) {
+				next = tbd.Add(-time.Duration(len(dayReactions)) * 24 * time.Hour)
+			}
+			tick = time.After(next.Sub(now))
+		}
+		select {
+		case <-tick:
+		case <-p.dueChanged:
+		case <-p.ended:
+			// the message is gone unless the deletion ended before
+			// calling the API
+			if _, state := p.status(); state != "deleting" && shown != "" {
+				fields.info("Remove :%s: from message %s(%s) since it is not deleted", shown, ch, msg.Timestamp)
+				remove(shown)
+			}
+			return
+		}
+	}
+}
+
+// postExpiryNote posts an ephemeral note in the thread of msg to its author
+// telling when msg will be deleted.
+func postExpiryNote(ch string, msg *slack.Message, tbd time.Time) {
+	fields := messageLog("preview", ch, msg.Timestamp)
+	if msg.User == "" {
+		return
+	}
+	if DRY_RUN {
+		fields.info("Post the expiry note of message %s(%s) (dry-run)", ch, msg.Timestamp)
+		return
+	}
+	text := fmt.Sprintf("This message will be deleted <!date^%d^{date_short_pretty} at {time}|at %s>.",
+		tbd.Unix(), tbd.UTC().Format(time.RFC1123))
+	thread := msg.ThreadTimestamp
+	if thread == "" {
+		thread = msg.Timestamp
+	}
+	waitAPI("chat.postEphemeral")
+	_, err := RTM.PostEphemeral(ch, msg.User, slack.MsgOptionText(text, false), slack.MsgOptionTS(thread))
+	if err != nil {
+		fields.errorlog("PostEphemeral(%s, %s) failed: %v", ch, msg.User, err)
+		return
+	}
+	fields.info("Posted the expiry note of message %s(%s) to %s", ch, msg.Timestamp, msg.User)
+}
@@ -0,0 +1,139 @@
+package blackhole
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// protection is an exemption of a message from deletion made by a user with
+// the message shortcut.
+type protection struct {
+	Channel     string    `json:"channel"`
+	TS          string    `json:"ts"`
+	User        string    `json:"user"`
+	ProtectedAt time.Time `json:"protected_at"`
+}
+
+var (
+	PROTECTED      = make(map[string]*protection)
+	PROTECTED_LOCK sync.Mutex
+)
+
+func protectionKey(ch, ts string) string {
+	return ch + "/" + ts
+}
+
+func initProtected() {
+	if PROTECTED_FILE == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(PROTECTED_FILE)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		fatal("ReadFile(%s) failed: %v", PROTECTED_FILE, err)
+	}
+	var list []*protection
+	err = json.Unmarshal(data, &list)
+	if err != nil {
+		fatal("Unmarshal(%s) failed: %v", PROTECTED_FILE, err)
+	}
+	for _, p := range list {
+		PROTECTED[protectionKey(p.Channel, p.TS)] = p
+	}
+	info("%d protected messages are loaded from %s", len(list), PROTECTED_FILE)
+}
+
+// saveProtected writes the protected messages to PROTECTED_FILE.
+// PROTECTED_LOCK must be held.
+func saveProtected() {
+	if PROTECTED_FILE == "" {
+		return
+	}
+	list := make([]*protection, 0, len(PROTECTED))
+	for _, p := range PROTECTED {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ProtectedAt.Before(list[j].ProtectedAt) })
+	data, err := json.MarshalIndent(list, "", "\t")
+	if err != nil {
+		errorlog("MarshalIndent protected messages failed: %v", err)
+		return
+	}
+	tmp := PROTECTED_FILE + ".tmp"
+	err = ioutil.WriteFile(tmp, append(data, '\n'), 0600)
+	if err == nil {
+		err = os.Rename(tmp, PROTECTED_FILE)
+	}
+	if err != nil {
+		errorlog("Saving protected messages to %s failed: %v", PROTECTED_FILE, err)
+	}
+}
+
+func protectMessage(ch, ts, user string) {
+	PROTECTED_LOCK.Lock()
+	defer PROTECTED_LOCK.Unlock()
+	PROTECTED[protectionKey(ch, ts)] = &protection{
+		Channel:     ch,
+		TS:          ts,
+		User:        user,
+		ProtectedAt: time.Now().UTC(),
+	}
+	saveProtected()
+	messageLog("protect", ch, ts).info("Message %s(%s) is protected by %s", ch, ts, user)
+}
+
+// protectedBy returns the user who protected the message, or "" if it is
+// not protected.
+func protectedBy(ch, ts string) string {
+	PROTECTED_LOCK.Lock()
+	defer PROTECTED_LOCK.Unlock()
+	if p, ok := PROTECTED[protectionKey(ch, ts)]; ok {
+		return p.User
+	}
+	return ""
+}
+
+func handleInteraction(w http.ResponseWriter, r *http.Request) {
+	body, ok := verifySlackRequest(w, r)
+	if !ok {
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var cb slack.InteractionCallback
+	if err := json.Unmarshal([]byte(r.PostFormValue("payload")), &cb); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if cb.Type != slack.InteractionTypeMessageAction || cb.CallbackID != PROTECT_CALLBACK_ID {
+		debug("Interaction ignored: %s %s", cb.Type, cb.CallbackID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ch, ts := cb.Channel.ID, cb.Message.Timestamp
+	protectMessage(ch, ts, cb.User.ID)
+	if cancelPending("message", ch, ts, "") {
+		messageLog("cancel", ch, ts).info("Deletion of message %s(%s) is canceled", ch, ts)
+	}
+	go func() {
+		err := slack.PostWebhook(cb.ResponseURL, &slack.WebhookMessage{Text: "This message is protected from slack-blackhole and will not be deleted."})
+		if err != nil {
+			errorlog("PostWebhook(response_url) failed: %v", err)
+		}
+	}()
+	w.WriteHeader(http.StatusOK)
+}
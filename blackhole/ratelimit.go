@@ -0,0 +1,136 @@
+package blackhole
+
+import (
+	"sync"
+	"time"
+)
+
+// apiTiers are the rate limit tiers of API methods.  Methods not listed are
+// Tier 3.  "mattermost" is all calls to the Mattermost API.
+var apiTiers = map[string]int{
+	"admin.conversations.getCustomRetention": 2,
+	"apps.permissions.info":                  2,
+	"auth.test":                              4,
+	"bookmarks.list":                         3,
+	"bookmarks.remove":                       2,
+	"canvases.delete":                        3,
+	"chat.delete":                            3,
+	"chat.deleteScheduledMessage":            3,
+	"chat.postEphemeral":                     4,
+	"chat.postMessage":                       3,
+	"chat.scheduledMessages.list":            3,
+	"conversations.history":                  3,
+	"conversations.info":                     3,
+	"conversations.join":                     3,
+	"conversations.list":                     2,
+	"conversations.replies":                  3,
+	"files.comments.delete":                  2,
+	"files.delete":                           3,
+	"files.info":                             4,
+	"files.list":                             3,
+	"files.revokePublicURL":                  3,
+	"mattermost":                             4,
+	"reactions.add":                          3,
+	"reactions.remove":                       2,
+	"reminders.list":                         2,
+	"rtm.connect":                            1,
+	"stars.list":                             3,
+	"users.info":                             4,
+}
+
+// tokenBucket allows rate calls per second with bursts up to capacity.
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// newTokenBucket returns the bucket for perMinute calls per minute, which
+// allows bursts of 1/10 of them.  0 means no limit.
+func newTokenBucket(perMinute int) *tokenBucket {
+	capacity := float64(perMinute) / 10
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &tokenBucket{
+		rate:     float64(perMinute) / 60,
+		capacity: capacity,
+		tokens:   capacity,
+		last:     time.Now(),
+	}
+}
+
+// wait blocks until a token is available and takes it.
+func (b *tokenBucket) wait() {
+	if b.rate <= 0 {
+		return
+	}
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+	b.tokens--
+	// a negative balance is the waiting time of the callers in line
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+var (
+	// API_BUCKETS has the token bucket of each method.  Slack limits
+	// each method separately, so scans of histories and deletions don't
+	// share their budgets even in the same tier.
+	API_BUCKETS      = make(map[string]*tokenBucket)
+	API_BUCKETS_LOCK sync.Mutex
+)
+
+func tierRate(tier int) int {
+	switch tier {
+	case 1:
+		return API_RATE_TIER1
+	case 2:
+		return API_RATE_TIER2
+	case 4:
+		return API_RATE_TIER4
+	default:
+		return API_RATE_TIER3
+	}
+}
+
+// waitAPI blocks until method can be called within its rate limit and
+// --slack-api-interval.
+func waitAPI(method string) {
+	if API_READY != nil {
+		<-API_READY
+	}
+	API_BUCKETS_LOCK.Lock()
+	b, ok := API_BUCKETS[method]
+	if !ok {
+		tier, ok := apiTiers[method]
+		if !ok {
+			tier = 3
+		}
+		b = newTokenBucket(tierRate(tier))
+		API_BUCKETS[method] = b
+	}
+	API_BUCKETS_LOCK.Unlock()
+	b.wait()
+}
+
+func initApiThrottle() {
+	for tier := 1; tier <= 4; tier++ {
+		if tierRate(tier) < 0 {
+			fatal("--api-rate-tier%d must not be negative", tier)
+		}
+	}
+	if SLACK_API_INTERVAL > 0 {
+		API_READY = time.NewTicker(time.Duration(SLACK_API_INTERVAL) * time.Second).C
+	}
+}
@@ -0,0 +1,95 @@
+package blackhole
+
+import (
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// managedReactions returns the reactions which slack-blackhole adds to
+// messages in ch by itself.  They are not cleaned up by reaction_ttl.
+func managedReactions(ch string) map[string]bool {
+	cfg := channelConfig(ch)
+	names := make(map[string]bool)
+	if cfg.WarnReaction != "" {
+		names[cfg.WarnReaction] = true
+	}
+	if cfg.ExpiryPreview == "reaction" {
+		for _, r := range dayReactions {
+			names[r] = true
+		}
+		names["calendar"] = true
+	}
+	return names
+}
+
+// inspectReactions removes reactions on msgs, the history of ch, and their
+// thread replies which are older than reaction_ttl.  Only the reactions of
+// the bot, and of the user of --slack-user-token with reaction_scope "all",
+// can be removed.  Reactions in a paused channel or out of the delete window
+// are left to later sweeps.
+func inspectReactions(ch string, msgs []slack.Message, sw *sweep) {
+	cfg := channelConfig(ch)
+	if cfg.ReactionTTL == 0 || sw.estimate {
+		return
+	}
+	fields := logFields{Action: "reaction", Channel: ch}
+	if !slackOnly("reaction_ttl", fields) {
+		return
+	}
+	if isPaused(ch) || !inDeleteWindow(ch) {
+		fields.debug("Reactions in %s are left to a later sweep", ch)
+		return
+	}
+	removers := map[string]*slack.Client{SELF_USER_ID: &RTM.Client}
+	if cfg.ReactionScope == "all" && USER_CLIENT != nil {
+		removers[USER_CLIENT_USER_ID] = USER_CLIENT
+	}
+	latest := slackTimestamp(time.Now().Add(-time.Duration(cfg.ReactionTTL) * time.Second))
+	skip := managedReactions(ch)
+	for i := range msgs {
+		msg := &msgs[i]
+		// replies are newer than their parent
+		if newerTimestamp(msg.Timestamp, latest) {
+			continue
+		}
+		removeReactions(ch, msg, removers, skip)
+		if msg.ReplyCount == 0 {
+			continue
+		}
+		replies, err := threadReplies(ch, msg, "", latest)
+		if err != nil {
+			messageLog("reaction", ch, msg.Timestamp).errorlog("GetConversationReplies(%s, %s) failed: %v", ch, msg.Timestamp, err)
+			continue
+		}
+		for j := range replies {
+			removeReactions(ch, &replies[j], removers, skip)
+		}
+	}
+}
+
+// removeReactions removes the reactions on msg of the users of removers
+// except those in skip.
+func removeReactions(ch string, msg *slack.Message, removers map[string]*slack.Client, skip map[string]bool) {
+	for _, r := range msg.Reactions {
+		if skip[r.Name] {
+			continue
+		}
+		for _, user := range r.Users {
+			c, ok := removers[user]
+			if !ok {
+				continue
+			}
+			fields := messageLog("reaction", ch, msg.Timestamp)
+			fields.info("Remove :%s: of %s from message %s(%s)", r.Name, user, ch, msg.Timestamp)
+			if DRY_RUN {
+				continue
+			}
+			waitAPI("reactions.remove")
+			err := c.RemoveReaction(r.Name, slack.NewRefToMessage(ch, msg.Timestamp))
+			if err != nil && err.Error() != "no_reaction" {
+				fields.errorlog("RemoveReaction(%s, %s, %s) failed: %v", r.Name, ch, msg.Timestamp, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package blackhole
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+var (
+	// RETENTION has the custom retention of channels set in Slack, which
+	// overrides --slack-retention.  0 means no custom retention.
+	RETENTION      = make(map[string]time.Duration)
+	RETENTION_LOCK sync.Mutex
+
+	// retentionQueryDisabled is set if the token is not permitted to get
+	// custom retentions.
+	retentionQueryDisabled bool
+
+	// retentionLogged is set once the effective policies are logged with
+	// --slack-retention only.
+	retentionLogged bool
+)
+
+// slackRetention returns the retention of ch set in Slack, or 0 if none.
+func slackRetention(ch string) time.Duration {
+	RETENTION_LOCK.Lock()
+	defer RETENTION_LOCK.Unlock()
+	if d, ok := RETENTION[ch]; ok && d > 0 {
+		return d
+	}
+	return SLACK_RETENTION
+}
+
+// purgedBySlackFirst returns true if Slack purges messages in ch by its
+// retention before ttl (sec) expires, so that deleting them is a waste.
+func purgedBySlackFirst(ch string, ttl int) bool {
+	r := slackRetention(ch)
+	return r > 0 && ttl > 0 && time.Duration(ttl)*time.Second >= r
+}
+
+// getCustomRetention gets the custom retention of ch with the admin API,
+// which is available on Enterprise Grid.
+func getCustomRetention(ch string) (time.Duration, error) {
+	token := SLACK_API_TOKEN
+	if SLACK_USER_TOKEN != "" {
+		token = SLACK_USER_TOKEN
+	}
+	var res struct {
+		IsPolicyEnabled bool `json:"is_policy_enabled"`
+		DurationDays    int  `json:"duration_days"`
+	}
+	err := callAPI(token, "admin.conversations.getCustomRetention", url.Values{"channel_id": {ch}}, &res)
+	if err != nil || !res.IsPolicyEnabled {
+		return 0, err
+	}
+	return time.Duration(res.DurationDays) * 24 * time.Hour, nil
+}
+
+// retentionNotPermitted returns true if err means that the token can never
+// get custom retentions.
+func retentionNotPermitted(err error) bool {
+	switch err.Error() {
+	case "not_allowed", "missing_scope":
+		return true
+	}
+	return false
+}
+
+// queryRetention updates the custom retentions of channels if
+// --query-retention is set, and logs the effective policy of channels
+// whose retention changed.
+func queryRetention(channels []slack.Channel) {
+	if !QUERY_RETENTION && SLACK_RETENTION > 0 && !retentionLogged {
+		for _, ch := range channels {
+			if POLICY.Managed(ch.ID) {
+				logRetention(ch.ID, ch.Name)
+			}
+		}
+		retentionLogged = true
+	}
+	if !QUERY_RETENTION || retentionQueryDisabled {
+		return
+	}
+	for _, ch := range channels {
+		if !POLICY.Managed(ch.ID) {
+			continue
+		}
+		waitAPI("admin.conversations.getCustomRetention")
+		d, err := getCustomRetention(ch.ID)
+		if err != nil {
+			if retentionNotPermitted(err) {
+				logFields{Action: "retention"}.errorlog("Getting the custom retention of %s failed; stop querying retentions: %v", ch.ID, err)
+				retentionQueryDisabled = true
+			} else {
+				logFields{Action: "retention"}.errorlog("Getting the custom retention of %s failed; retry on the next sweep: %v", ch.ID, err)
+			}
+			return
+		}
+		RETENTION_LOCK.Lock()
+		old, ok := RETENTION[ch.ID]
+		RETENTION[ch.ID] = d
+		RETENTION_LOCK.Unlock()
+		if !ok || old != d {
+			logRetention(ch.ID, ch.Name)
+		}
+	}
+}
+
+// logRetention logs the policy of ch combined with the retention of Slack.
+func logRetention(id, name string) {
+	ttl := POLICY.MessageTTL(id)
+	r := slackRetention(id)
+	fields := logFields{Action: "retention", Channel: id}
+	switch {
+	case r == 0:
+		fields.debug("#%s: message TTL %s, no Slack retention", name, formatTTL(ttl))
+	case purgedBySlackFirst(id, ttl):
+		fields.info("#%s: message TTL %s, Slack retention %v; Slack purges messages first and they are not deleted", name, formatTTL(ttl), r)
+	default:
+		fields.info("#%s: message TTL %s, Slack retention %v", name, formatTTL(ttl), r)
+	}
+}
@@ -0,0 +1,110 @@
+package blackhole
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Classes of errors of deletion API calls.
+const (
+	// errorGone means that the item is already deleted, which is a
+	// success.
+	errorGone = "gone"
+
+	// errorPermanent means that retrying doesn't help, e.g. the token
+	// lacks the privilege.
+	errorPermanent = "permanent"
+
+	// errorTransient is the other errors like rate limits and network
+	// errors.
+	errorTransient = "transient"
+)
+
+// errorClasses classifies error codes of the deletion APIs.  Codes not
+// listed are transient.  --error-classes adds to or overrides them.
+var errorClasses = map[string]string{
+	"canvas_not_found":  errorGone,
+	"file_deleted":      errorGone,
+	"file_not_found":    errorGone,
+	"message_not_found": errorGone,
+
+	"account_inactive":                    errorPermanent,
+	"cant_delete_file":                    errorPermanent,
+	"cant_delete_message":                 errorPermanent,
+	"channel_not_found":                   errorPermanent,
+	"compliance_exports_prevent_deletion": errorPermanent,
+	"ekm_access_denied":                   errorPermanent,
+	"invalid_auth":                        errorPermanent,
+	"is_archived":                         errorPermanent,
+	"missing_scope":                       errorPermanent,
+	"not_allowed_token_type":              errorPermanent,
+	"not_authed":                          errorPermanent,
+	"not_in_channel":                      errorPermanent,
+	"not_supported":                       errorPermanent,
+	"restricted_action":                   errorPermanent,
+	"token_expired":                       errorPermanent,
+	"token_revoked":                       errorPermanent,
+}
+
+func initErrorClasses() {
+	for _, s := range strings.Split(ERROR_CLASSES, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			fatal("--error-classes must be like cant_delete_message=transient: %s", s)
+		}
+		switch kv[1] {
+		case errorGone, errorPermanent, errorTransient:
+			errorClasses[kv[0]] = kv[1]
+		default:
+			fatal("Class of %s in --error-classes must be gone, permanent or transient: %s", kv[0], kv[1])
+		}
+	}
+	if MAX_RETRIES < 1 || MAX_RETRIES_PERMANENT < 1 {
+		fatal("--max-retries and --max-retries-permanent must be positive")
+	}
+}
+
+// errorClass returns the class of err returned by a deletion API.
+func errorClass(err error) string {
+	if c, ok := errorClasses[err.Error()]; ok {
+		return c
+	}
+	return errorTransient
+}
+
+// retryBackoff returns the time to wait before retrying the deletion which
+// failed with err in the attempt (0 for the first), or false if it is
+// given up.  The backoff is doubled every attempt and is at least the
+// Retry-After of rate limits.
+func retryBackoff(err error, attempt int) (time.Duration, bool) {
+	max, backoff := MAX_RETRIES, RETRY_BACKOFF
+	if errorClass(err) == errorPermanent {
+		max, backoff = MAX_RETRIES_PERMANENT, RETRY_BACKOFF_PERMANENT
+	}
+	if attempt+1 >= max {
+		return 0, false
+	}
+	backoff <<= uint(attempt)
+	var rl *slack.RateLimitedError
+	if errors.As(err, &rl) && rl.RetryAfter > backoff {
+		backoff = rl.RetryAfter
+	}
+	return backoff, true
+}
+
+// giveUpReason describes why a deletion which failed with err in attempts
+// is given up.
+func giveUpReason(err error, attempts int) string {
+	if errorClass(err) == errorPermanent {
+		return fmt.Sprintf("with the permanent error after %d attempts: %v", attempts, err)
+	}
+	return fmt.Sprintf("for %d times: %v", attempts, err)
+}
@@ -0,0 +1,60 @@
+package blackhole
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestErrorClass(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{errors.New("message_not_found"), errorGone},
+		{errors.New("file_deleted"), errorGone},
+		{errors.New("cant_delete_message"), errorPermanent},
+		{errors.New("missing_scope"), errorPermanent},
+		{errors.New("internal_error"), errorTransient},
+		{&slack.RateLimitedError{RetryAfter: time.Second}, errorTransient},
+	} {
+		if got := errorClass(tc.err); got != tc.want {
+			t.Errorf("errorClass(%v) = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	defer func(max, maxPermanent int, backoff, backoffPermanent time.Duration) {
+		MAX_RETRIES, MAX_RETRIES_PERMANENT = max, maxPermanent
+		RETRY_BACKOFF, RETRY_BACKOFF_PERMANENT = backoff, backoffPermanent
+	}(MAX_RETRIES, MAX_RETRIES_PERMANENT, RETRY_BACKOFF, RETRY_BACKOFF_PERMANENT)
+	MAX_RETRIES, MAX_RETRIES_PERMANENT = 3, 2
+	RETRY_BACKOFF, RETRY_BACKOFF_PERMANENT = time.Second, time.Hour
+
+	transient := errors.New("internal_error")
+	permanent := errors.New("cant_delete_message")
+	rateLimited := &slack.RateLimitedError{RetryAfter: 10 * time.Second}
+	for _, tc := range []struct {
+		err     error
+		attempt int
+		backoff time.Duration
+		ok      bool
+	}{
+		{transient, 0, time.Second, true},
+		{transient, 1, 2 * time.Second, true},
+		{transient, 2, 0, false},
+		{permanent, 0, time.Hour, true},
+		{permanent, 1, 0, false},
+		{rateLimited, 0, 10 * time.Second, true},
+		{rateLimited, 1, 10 * time.Second, true},
+		{rateLimited, 2, 0, false},
+	} {
+		backoff, ok := retryBackoff(tc.err, tc.attempt)
+		if backoff != tc.backoff || ok != tc.ok {
+			t.Errorf("retryBackoff(%v, %d) = %v, %v, want %v, %v", tc.err, tc.attempt, backoff, ok, tc.backoff, tc.ok)
+		}
+	}
+}
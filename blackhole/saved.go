@@ -0,0 +1,108 @@
+package blackhole
+
+import (
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// savedRefresh is how long the saved items and reminders are cached.
+const savedRefresh = 5 * time.Minute
+
+// permalinkRe matches permalinks of messages in texts of reminders.
+var permalinkRe = regexp.MustCompile(`/archives/([A-Z0-9]+)/p(\d{10})(\d{6})`)
+
+var (
+	// SAVED has messages saved or referenced by open reminders of the user
+	// of --slack-user-token, and SAVED_ERR is the error of loading it.
+	SAVED        map[string]bool
+	SAVED_ERR    error
+	SAVED_LOADED time.Time
+	// SAVED_LOADING is true while SAVED is being loaded without SAVED_LOCK
+	// held.  SAVED_COND is signaled when it is done.
+	SAVED_LOADING bool
+	SAVED_LOCK    sync.Mutex
+	SAVED_COND    = sync.NewCond(&SAVED_LOCK)
+	SAVED_WARNING sync.Once
+)
+
+// loadSaved lists the saved items and the open reminders of the user of
+// USER_CLIENT.  The Slack API tells them only for the user of the token.
+func loadSaved() (map[string]bool, error) {
+	saved := make(map[string]bool)
+	params := slack.NewStarsParameters()
+	for hasMore := true; hasMore; params.Page++ {
+		waitAPI("stars.list")
+		items, paging, err := USER_CLIENT.ListStars(params)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if item.Type == "message" && item.Message != nil {
+				saved[item.Channel+"/"+item.Message.Timestamp] = true
+			}
+		}
+		hasMore = paging.Page < paging.Pages
+	}
+	waitAPI("reminders.list")
+	reminders, err := USER_CLIENT.ListReminders()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range reminders {
+		if r.CompleteTS != 0 {
+			continue
+		}
+		for _, m := range permalinkRe.FindAllStringSubmatch(r.Text, -1) {
+			saved[m[1]+"/"+m[2]+"."+m[3]] = true
+		}
+	}
+	return saved, nil
+}
+
+// savedSet returns SAVED, which is loaded again if it is older than
+// savedRefresh.  The API is called without SAVED_LOCK held, and the others
+// meanwhile get the old one, or wait if it is not loaded yet.
+func savedSet() (map[string]bool, error) {
+	SAVED_LOCK.Lock()
+	defer SAVED_LOCK.Unlock()
+	for SAVED_LOADING && SAVED_LOADED.IsZero() {
+		SAVED_COND.Wait()
+	}
+	if SAVED_LOADING || time.Since(SAVED_LOADED) <= savedRefresh {
+		return SAVED, SAVED_ERR
+	}
+	SAVED_LOADING = true
+	SAVED_LOCK.Unlock()
+	saved, err := loadSaved()
+	SAVED_LOCK.Lock()
+	SAVED, SAVED_ERR, SAVED_LOADED, SAVED_LOADING = saved, err, time.Now(), false
+	SAVED_COND.Broadcast()
+	return saved, err
+}
+
+// savedMessage returns true if msg is saved (starred) or referenced by an
+// open reminder.  Only the saved items and reminders of the user of
+// --slack-user-token are visible, in addition to is_starred of msg for the
+// token of --slack-api-token.  It returns an error if they are not known.
+func savedMessage(ch string, msg *slack.Message) (bool, error) {
+	if msg.IsStarred {
+		return true, nil
+	}
+	if USER_CLIENT == nil {
+		SAVED_WARNING.Do(func() {
+			info("keep_saved needs --slack-user-token to check saved items and reminders")
+		})
+		return false, nil
+	}
+	SAVED_WARNING.Do(func() {
+		info("keep_saved sees only the saved items and reminders of %s, the user of --slack-user-token", USER_CLIENT_USER_ID)
+	})
+	saved, err := savedSet()
+	if err != nil {
+		return false, err
+	}
+	return saved[ch+"/"+msg.Timestamp], nil
+}
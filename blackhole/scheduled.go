@@ -0,0 +1,66 @@
+package blackhole
+
+import (
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// inspectScheduledMessages deletes messages scheduled by the app with
+// chat.scheduleMessage whose message TTL has expired since they were
+// scheduled.  Those in paused channels or out of the delete window are left
+// to later sweeps.
+func inspectScheduledMessages(sw *sweep) {
+	if !SCHEDULED_MESSAGES || sw.estimate {
+		return
+	}
+	params := &slack.GetScheduledMessagesParameters{}
+	var msgs []slack.ScheduledMessage
+	for cont := true; cont; {
+		waitAPI("chat.scheduledMessages.list")
+		res, cursor, err := RTM.GetScheduledMessages(params)
+		if err != nil {
+			logFields{Action: "scheduled"}.errorlog("GetScheduledMessages() failed: %v", err)
+			return
+		}
+		msgs = append(msgs, res...)
+		params.Cursor = cursor
+		cont = cursor != ""
+	}
+
+	for i := range msgs {
+		m := &msgs[i]
+		if !POLICY.Managed(m.Channel) || isPaused(m.Channel) || !inDeleteWindow(m.Channel) {
+			continue
+		}
+		ttl := POLICY.MessageTTL(m.Channel)
+		if ttl == 0 {
+			continue
+		}
+		created := time.Unix(int64(m.DateCreated), 0)
+		tbd := created.Add(time.Duration(ttl) * time.Second)
+		if tbd.After(time.Now()) {
+			continue
+		}
+		if !sw.admitMessage(m.Channel, tbd) {
+			continue
+		}
+		fields := logFields{Action: "scheduled", Channel: m.Channel, TS: m.ID}
+		fields.info("Delete scheduled message %s in %s created %v (post_at=%v)", m.ID, m.Channel, created, time.Unix(int64(m.PostAt), 0))
+		if DRY_RUN {
+			continue
+		}
+		waitAPI("chat.deleteScheduledMessage")
+		_, err := RTM.DeleteScheduledMessage(&slack.DeleteScheduledMessageParameters{
+			Channel:            m.Channel,
+			ScheduledMessageID: m.ID,
+		})
+		if err != nil {
+			fields.errorlog("DeleteScheduledMessage(%s, %s) failed: %v", m.Channel, m.ID, err)
+			recordDeletionError(fields)
+			continue
+		}
+		auditScheduledMessage(m)
+		recordStats(m.Channel, channelStats{Messages: 1})
+	}
+}
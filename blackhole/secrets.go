@@ -0,0 +1,63 @@
+package blackhole
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// readSecret returns the secret from file, or from the systemd credential
+// named credential if file is empty.  It returns "" if neither is set.
+func readSecret(file, credential string) string {
+	if file == "" {
+		dir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if dir == "" {
+			return ""
+		}
+		file = filepath.Join(dir, credential)
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			return ""
+		}
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		fatal("ReadFile(%s) failed: %v", file, err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// runTokenCommand runs TOKEN_COMMAND with the shell, or cmd on Windows, and
+// returns its output.
+func runTokenCommand() string {
+	cmd := exec.Command("/bin/sh", "-c", TOKEN_COMMAND)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", TOKEN_COMMAND)
+	}
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		fatal("--token-command failed: %v", err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// initSecrets resolves the tokens given by files, systemd credentials or
+// the command, and registers all secrets to be redacted from logs.
+func initSecrets() {
+	if SLACK_API_TOKEN == "" {
+		SLACK_API_TOKEN = readSecret(SLACK_API_TOKEN_FILE, "slack-api-token")
+	}
+	if SLACK_API_TOKEN == "" && TOKEN_COMMAND != "" {
+		SLACK_API_TOKEN = runTokenCommand()
+	}
+	if SLACK_USER_TOKEN == "" {
+		SLACK_USER_TOKEN = readSecret(SLACK_USER_TOKEN_FILE, "slack-user-token")
+	}
+	if SLACK_SIGNING_SECRET == "" {
+		SLACK_SIGNING_SECRET = readSecret("", "slack-signing-secret")
+	}
+	log.redact(SLACK_API_TOKEN, SLACK_USER_TOKEN, SLACK_SIGNING_SECRET, ADMIN_API_TOKEN)
+}
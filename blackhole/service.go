@@ -0,0 +1,85 @@
+package blackhole
+
+import (
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// eventLoopStall is the duration without events after which the event loop
+// is regarded as stalled.  Even if the workspace is quiet, the RTM connection
+// of Slack receives a latency report every 30 seconds, and the Mattermost
+// backend sends one on each pong to its ping every 30 seconds.
+const eventLoopStall = 2 * time.Minute
+
+// lastEventAt is the UnixNano time when the event loop handled an event.
+var lastEventAt int64
+
+func eventLoopAlive() {
+	atomic.StoreInt64(&lastEventAt, time.Now().UnixNano())
+}
+
+func lastEventTime() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&lastEventAt))
+}
+
+// startWatchdog notifies systemd that the service is ready, and keeps
+// sending WATCHDOG=1 while the event loop is alive so that systemd restarts
+// the service if it stalls.
+func startWatchdog() {
+	eventLoopAlive()
+	sdNotify("READY=1")
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+	info("systemd watchdog is enabled; pinging every %v", interval)
+	go func() {
+		for range time.Tick(interval) {
+			last := lastEventTime()
+			if time.Since(last) > eventLoopStall {
+				errorlog("The event loop has stalled since %v; stop pinging the watchdog", last)
+				continue
+			}
+			sdNotify("WATCHDOG=1")
+		}
+	}()
+}
+
+// handleSignals stops the service cleanly on SIGINT or SIGTERM, which are
+// sent by systemd and service wrappers on Windows.
+func handleSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-ch
+		stopTUI()
+		info("Received %v; stopping", sig)
+		shutdown()
+	}()
+}
+
+// shutdown stops receiving events and taking deletion jobs, waits up to
+// --shutdown-timeout for the running deletions to be done, saves the state
+// and exits.  Deletions left are scheduled again by the sweep on the next
+// start.
+func shutdown() {
+	sdNotify("STOPPING=1")
+	if RTM != nil {
+		RTM.Disconnect()
+	}
+	running, queued := DISPATCHER.stop(SHUTDOWN_TIMEOUT)
+	if running > 0 {
+		errorlog("%d deletions are still running after %v; stopping anyway", running, SHUTDOWN_TIMEOUT)
+	}
+	if queued > 0 {
+		info("%d queued deletions are left to the next start", queued)
+	}
+	if TRACER != nil {
+		TRACER.export()
+	}
+	saveStats()
+	os.Exit(0)
+}
@@ -0,0 +1,192 @@
+package blackhole
+
+import (
+	"sort"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// SHADOW_CONFIGS has the configs of --shadow-config-file keyed by channel
+// name.  They are only evaluated on sweeps and compared with the configs in
+// use.
+var SHADOW_CONFIGS map[string]Config
+
+func initShadow() {
+	if SHADOW_CONFIG_FILE == "" {
+		return
+	}
+	SHADOW_CONFIGS = make(map[string]Config)
+	for _, cfg := range readConfigFile(SHADOW_CONFIG_FILE) {
+		SHADOW_CONFIGS[cfg.Channel] = cfg
+	}
+	info("Shadow config: %d channels are loaded from %s; differences from the config are reported on sweeps", len(SHADOW_CONFIGS), SHADOW_CONFIG_FILE)
+}
+
+// decision is what a policy does with a message or a file on a sweep: it is
+// kept for the reason, or deleted at the time if the reason is "".
+type decision struct {
+	keep string
+	at   time.Time
+}
+
+func (d decision) String() string {
+	if d.keep != "" {
+		return "keep (" + d.keep + ")"
+	}
+	return "delete at " + d.at.Format(time.RFC3339)
+}
+
+func (d decision) differs(other decision) bool {
+	if d.keep != "" || other.keep != "" {
+		return (d.keep == "") != (other.keep == "")
+	}
+	return !d.at.Equal(other.at)
+}
+
+// policyView is a policy evaluated for a channel: the config in use or the
+// shadow config.
+type policyView struct {
+	cfg        Config
+	managed    bool
+	messageTTL int
+	fileTTL    int
+}
+
+func currentView(ch string) policyView {
+	return policyView{
+		cfg:        channelConfig(ch),
+		managed:    POLICY.Managed(ch),
+		messageTTL: POLICY.MessageTTL(ch),
+		fileTTL:    POLICY.FileTTL(ch),
+	}
+}
+
+func shadowView(ch, name string) policyView {
+	cfg, ok := SHADOW_CONFIGS[name]
+	return policyView{
+		cfg:        cfg,
+		managed:    !EXCLUDED[ch] && (ok || POLICY_MODE != "allowlist"),
+		messageTTL: cfg.calendarTTL(directiveTTL(ch, cfg.MessageTTL, DEFAULT_MESSAGE_TTL)),
+		fileTTL:    cfg.calendarTTL(directiveTTL(ch, cfg.FileTTL, DEFAULT_FILE_TTL)),
+	}
+}
+
+// messageDecision decides on msg in ch, which is the i-th newest message,
+// in the same way as inspectHistory.
+func (v policyView) messageDecision(ch string, msg *slack.Message, i int, now time.Time) decision {
+	if !v.managed {
+		return decision{keep: "not managed"}
+	}
+	if reason := exemptionBy(v.cfg, ch, msg); reason != "" {
+		return decision{keep: reason}
+	}
+	if v.cfg.MaxMessages > 0 && i >= v.cfg.MaxMessages {
+		return decision{at: now}
+	}
+	if v.messageTTL == 0 {
+		return decision{keep: "no TTL"}
+	}
+	tbd, err := v.cfg.messageDeadline(ch, msg, v.messageTTL)
+	if err != nil {
+		return decision{keep: err.Error()}
+	}
+	if tbd.Before(now) {
+		tbd = now
+	}
+	return decision{at: tbd}
+}
+
+func (v policyView) fileDecision(file *slack.File, now time.Time) decision {
+	if !v.managed {
+		return decision{keep: "not managed"}
+	}
+	if v.fileTTL == 0 {
+		return decision{keep: "no TTL"}
+	}
+	tbd := v.cfg.retainUntilDeadline(file.Timestamp.Time().Add(time.Duration(v.fileTTL) * time.Second))
+	if tbd.Before(now) {
+		tbd = now
+	}
+	return decision{at: tbd}
+}
+
+// shadowMessage compares the decisions on msg, which is the i-th newest
+// message in ch, by the config and the shadow config.
+func (sw *sweep) shadowMessage(ch string, msg *slack.Message, i int, now time.Time) {
+	if SHADOW_CONFIGS == nil || sw.estimate {
+		return
+	}
+	cur := currentView(ch).messageDecision(ch, msg, i, now)
+	shadow := shadowView(ch, sw.names[ch]).messageDecision(ch, msg, i, now)
+	if cur.differs(shadow) {
+		sw.countShadowDiff(ch)
+		messageLog("shadow", ch, msg.Timestamp).info("Message %s(%s): %v by the config, %v by the shadow config", ch, msg.Timestamp, cur, shadow)
+	}
+}
+
+// shadowFile compares the decisions on file by the config and the shadow
+// config.  Only files in a channel except canvases are compared.
+func (sw *sweep) shadowFile(file *slack.File, now time.Time) {
+	if SHADOW_CONFIGS == nil || sw.estimate || len(file.Channels) != 1 || isCanvas(file) {
+		return
+	}
+	ch := file.Channels[0]
+	cur := currentView(ch).fileDecision(file, now)
+	shadow := shadowView(ch, sw.names[ch]).fileDecision(file, now)
+	if cur.differs(shadow) {
+		sw.countShadowDiff(ch)
+		fileLog("shadow", file.ID).info("File %s in %s: %v by the config, %v by the shadow config", file.ID, ch, cur, shadow)
+	}
+}
+
+func (sw *sweep) countShadowDiff(ch string) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.shadowDiffs[ch]++
+}
+
+// shadowHistory compares the decisions on messages in ch which is not swept
+// by the config but may be by the shadow config.
+func (sw *sweep) shadowHistory(ch slack.Channel) {
+	if SHADOW_CONFIGS == nil || sw.estimate {
+		return
+	}
+	v := shadowView(ch.ID, ch.Name)
+	if !v.managed || (v.messageTTL == 0 && v.cfg.MaxMessages == 0) || (SELF_IS_BOT && !ch.IsMember) {
+		return
+	}
+	msgs, err := BACKEND.History(ch.ID, "", "")
+	if err != nil {
+		logFields{Action: "shadow", Channel: ch.ID}.errorlog("History() for %s failed: %v", ch.ID, err)
+		return
+	}
+	now := time.Now()
+	for i := range msgs {
+		if !isTombstone(&msgs[i]) {
+			sw.shadowMessage(ch.ID, &msgs[i], i, now)
+		}
+	}
+}
+
+// reportShadow logs the numbers of differences by the shadow config.
+func (sw *sweep) reportShadow() {
+	if SHADOW_CONFIGS == nil || sw.estimate {
+		return
+	}
+	var chs []string
+	total := 0
+	for ch, n := range sw.shadowDiffs {
+		chs = append(chs, ch)
+		total += n
+	}
+	if total == 0 {
+		logFields{Action: "shadow"}.info("No decisions differ by the shadow config")
+		return
+	}
+	sort.Strings(chs)
+	for _, ch := range chs {
+		logFields{Action: "shadow", Channel: ch}.info("%s decisions differ by the shadow config in %s", formatCount(sw.shadowDiffs[ch]), sw.channelName(ch))
+	}
+	logFields{Action: "shadow"}.info("%s decisions differ by the shadow config in %d channels", formatCount(total), len(chs))
+}
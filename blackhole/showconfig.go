@@ -0,0 +1,157 @@
+package blackhole
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// effectivePolicy is the policy applied to a channel after resolving the
+// config, the defaults and the channel lists.
+type effectivePolicy struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Source       string   `json:"source"`
+	Managed      bool     `json:"managed"`
+	MessageTTL   int      `json:"message_ttl"`
+	FileTTL      int      `json:"file_ttl"`
+	RetainUntil  string   `json:"retain_until,omitempty"`
+	MaxMessages  int      `json:"max_messages,omitempty"`
+	MaxFileBytes int64    `json:"max_file_bytes,omitempty"`
+	DeleteWindow string   `json:"delete_window,omitempty"`
+	Exemptions   []string `json:"exemptions,omitempty"`
+}
+
+// policySource returns where the policy of ch comes from.
+func policySource(ch string) string {
+	CONFIG_LOCK.RLock()
+	_, configured := CONFIG_BY_ID[ch]
+	CONFIG_LOCK.RUnlock()
+	_, directive := topicTTL(ch)
+	switch {
+	case EXCLUDED[ch]:
+		return "excluded"
+	case !configured && POLICY_MODE == "allowlist":
+		return "not in allowlist"
+	case directive && (!configured || TOPIC_DIRECTIVE_PRECEDENCE == "topic"):
+		return "topic"
+	case configured:
+		return "config"
+	default:
+		return "default"
+	}
+}
+
+func resolvePolicy(id, name string) effectivePolicy {
+	cfg := channelConfig(id)
+	p := effectivePolicy{
+		ID:      id,
+		Name:    name,
+		Source:  policySource(id),
+		Managed: POLICY.Managed(id),
+	}
+	if !p.Managed {
+		return p
+	}
+	// TTLs without calendarTTL
+	p.MessageTTL = directiveTTL(id, cfg.MessageTTL, DEFAULT_MESSAGE_TTL)
+	p.FileTTL = directiveTTL(id, cfg.FileTTL, DEFAULT_FILE_TTL)
+	if cfg.RetainUntil != "" {
+		p.RetainUntil = cfg.RetainUntil
+		if cfg.RetainTZ != "" {
+			p.RetainUntil += " " + cfg.RetainTZ
+		}
+	}
+	p.MaxMessages = cfg.MaxMessages
+	p.MaxFileBytes = cfg.MaxFileBytes
+	if cfg.DeleteWindow != "" {
+		p.DeleteWindow = cfg.DeleteWindow
+	} else {
+		p.DeleteWindow = DELETE_WINDOW
+	}
+	if cfg.OnlyBots {
+		p.Exemptions = append(p.Exemptions, "non-bot messages (only_bots)")
+	}
+	if cfg.SkipBots {
+		p.Exemptions = append(p.Exemptions, "bot messages (skip_bots)")
+	}
+	if len(cfg.IncludeApps) > 0 {
+		p.Exemptions = append(p.Exemptions, fmt.Sprintf("messages not from %s (include_apps)", strings.Join(cfg.IncludeApps, ", ")))
+	}
+	if len(cfg.ExcludeApps) > 0 {
+		p.Exemptions = append(p.Exemptions, fmt.Sprintf("messages from %s (exclude_apps)", strings.Join(cfg.ExcludeApps, ", ")))
+	}
+	for _, s := range cfg.KeepPatterns {
+		p.Exemptions = append(p.Exemptions, fmt.Sprintf("matching %q", s))
+	}
+	return p
+}
+
+// showConfig prints the effective policy of all channels and exits.
+func showConfig() {
+	switch SHOW_CONFIG_FORMAT {
+	case "table", "json":
+	default:
+		fatal("Unknown output format: %s", SHOW_CONFIG_FORMAT)
+	}
+	log.out = os.Stderr
+	initPolicyMode()
+	initApiThrottle()
+	initBackendClient()
+	initTTL()
+	initExcludeChannels()
+
+	channels, err := BACKEND.ListConversations()
+	if err != nil {
+		fatal("getting the list of channels failed: %v", err)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	policies := []effectivePolicy{}
+	for _, ch := range channels {
+		setChannelTextOf(ch)
+		policies = append(policies, resolvePolicy(ch.ID, ch.Name))
+	}
+
+	if SHOW_CONFIG_FORMAT == "json" {
+		data, err := json.MarshalIndent(policies, "", "\t")
+		if err != nil {
+			fatal("MarshalIndent failed: %v", err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANNEL\tID\tSOURCE\tMESSAGE TTL\tFILE TTL\tWINDOW\tEXEMPTIONS")
+	for _, p := range policies {
+		if !p.Managed {
+			fmt.Fprintf(w, "#%s\t%s\t%s\t-\t-\t-\t-\n", p.Name, p.ID, p.Source)
+			continue
+		}
+		window := p.DeleteWindow
+		if window == "" {
+			window = "-"
+		}
+		exemptions := strings.Join(p.Exemptions, ", ")
+		if exemptions == "" {
+			exemptions = "-"
+		}
+		fmt.Fprintf(w, "#%s\t%s\t%s\t%s\t%s\t%s\t%s\n", p.Name, p.ID, p.Source,
+			formatRetention(p.MessageTTL, p.RetainUntil), formatRetention(p.FileTTL, p.RetainUntil), window, exemptions)
+	}
+	w.Flush()
+}
+
+// formatRetention formats ttl followed by retain_until like "7d, end_of_month".
+func formatRetention(ttl int, until string) string {
+	switch {
+	case until == "":
+		return formatTTL(ttl)
+	case ttl == 0:
+		return until
+	default:
+		return formatTTL(ttl) + ", " + until
+	}
+}
@@ -0,0 +1,167 @@
+package blackhole
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// simulation is the result of applying the policy to a channel in an export.
+type simulation struct {
+	channel  slack.Channel
+	managed  bool
+	messages int
+	deleted  int
+	retained int
+	exempted int
+}
+
+func readZipJSON(f *zip.File, v interface{}) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// readExport reads channels and their messages from a Slack export zip.
+// Messages are sorted from newest to oldest like conversations.history.
+func readExport(name string) ([]slack.Channel, map[string][]slack.Message, error) {
+	z, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer z.Close()
+
+	var channels []slack.Channel
+	for _, f := range z.File {
+		if f.Name != "channels.json" && f.Name != "groups.json" {
+			continue
+		}
+		var chs []slack.Channel
+		if err := readZipJSON(f, &chs); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		channels = append(channels, chs...)
+	}
+	if len(channels) == 0 {
+		return nil, nil, fmt.Errorf("no channels.json in %s", name)
+	}
+	idByName := make(map[string]string)
+	for _, ch := range channels {
+		idByName[ch.Name] = ch.ID
+	}
+
+	msgs := make(map[string][]slack.Message)
+	for _, f := range z.File {
+		dir, file := path.Split(f.Name)
+		id, ok := idByName[strings.TrimSuffix(dir, "/")]
+		if !ok || !strings.HasSuffix(file, ".json") {
+			continue
+		}
+		var day []slack.Message
+		if err := readZipJSON(f, &day); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		msgs[id] = append(msgs[id], day...)
+	}
+	for id := range msgs {
+		m := msgs[id]
+		sort.Slice(m, func(i, j int) bool { return newerTimestamp(m[i].Timestamp, m[j].Timestamp) })
+	}
+	return channels, msgs, nil
+}
+
+// simulateChannel applies the policy of ch to msgs at now in the same way
+// as sweeps.
+func simulateChannel(ch slack.Channel, msgs []slack.Message, now time.Time) simulation {
+	sim := simulation{channel: ch, managed: POLICY.Managed(ch.ID), messages: len(msgs)}
+	if !sim.managed {
+		sim.retained = len(msgs)
+		return sim
+	}
+	touchChannelHistory(ch.ID, msgs)
+	setChannelTextOf(ch)
+	cfg := channelConfig(ch.ID)
+	ttl := POLICY.MessageTTL(ch.ID)
+	parents := 0
+	for i := range msgs {
+		msg := &msgs[i]
+		reply := msg.ThreadTimestamp != "" && msg.ThreadTimestamp != msg.Timestamp
+		exceeded := false
+		if !reply && !isTombstone(msg) {
+			exceeded = cfg.MaxMessages > 0 && parents >= cfg.MaxMessages
+			parents++
+		}
+		if exemption(ch.ID, msg) != "" {
+			sim.exempted++
+			continue
+		}
+		if exceeded {
+			sim.deleted++
+			continue
+		}
+		tbd, err := messageDeadline(ch.ID, msg, ttl)
+		if ttl > 0 && err == nil && !tbd.After(now) {
+			sim.deleted++
+		} else {
+			sim.retained++
+		}
+	}
+	return sim
+}
+
+// simulate applies the policies to a Slack export zip offline and reports
+// what would be deleted and retained in each channel.
+func simulate() {
+	log.out = os.Stderr
+	if flag.NArg() != 1 {
+		fatal("Usage: slack-blackhole simulate [flags] <export.zip>")
+	}
+	initPolicyMode()
+	channels, msgs, err := readExport(flag.Arg(0))
+	if err != nil {
+		fatal("Reading the export failed: %v", err)
+	}
+	if CONFIG_FILE != "" || CHANNEL_TTLS != "" {
+		loadConfig(channels)
+	}
+	if EXCLUDE_CHANNELS != "" {
+		excludeChannels(channels)
+	}
+
+	now := time.Now()
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANNEL\tMESSAGES\tDELETED\tRETAINED\tEXEMPTED\tNOTE")
+	var total simulation
+	for _, ch := range channels {
+		sim := simulateChannel(ch, msgs[ch.ID], now)
+		note := ""
+		if !sim.managed {
+			note = "not managed"
+		}
+		fmt.Fprintf(w, "#%s\t%d\t%d\t%d\t%d\t%s\n", ch.Name, sim.messages, sim.deleted, sim.retained, sim.exempted, note)
+		total.messages += sim.messages
+		total.deleted += sim.deleted
+		total.retained += sim.retained
+		total.exempted += sim.exempted
+	}
+	fmt.Fprintf(w, "total\t%d\t%d\t%d\t%d\t\n", total.messages, total.deleted, total.retained, total.exempted)
+	w.Flush()
+}
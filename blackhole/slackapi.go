@@ -0,0 +1,50 @@
+package blackhole
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+var apiClient = &http.Client{Timeout: 30 * time.Second}
+
+// callAPI calls the Slack Web API method which is not supported by
+// slack-go with token and decodes the response into res.  res may be nil.
+// It doesn't wait for waitAPI.
+func callAPI(token, method string, params url.Values, res interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, slack.APIURL+method, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+token)
+	r, err := apiClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", method, r.Status)
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return err
+	}
+	var status slack.SlackResponse
+	if err := json.Unmarshal(body, &status); err != nil {
+		return err
+	}
+	if !status.Ok {
+		return fmt.Errorf("%s", status.Error)
+	}
+	if res == nil {
+		return nil
+	}
+	return json.Unmarshal(body, res)
+}
@@ -0,0 +1,198 @@
+package blackhole
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsSaveInterval is how often the stats are saved to STATS_FILE if they
+// have changed.
+const statsSaveInterval = time.Minute
+
+// channelStats is the cumulative numbers of deletions.  Failures are
+// deletions which were given up.
+type channelStats struct {
+	Messages  int64 `json:"messages"`
+	Files     int64 `json:"files"`
+	FileBytes int64 `json:"file_bytes"`
+	Failures  int64 `json:"failures"`
+}
+
+func (s *channelStats) String() string {
+	return fmt.Sprintf("%d messages, %d files (%s), %d failures", s.Messages, s.Files, formatBytes(s.FileBytes), s.Failures)
+}
+
+type deletionStats struct {
+	Since    time.Time                `json:"since"`
+	Total    channelStats             `json:"total"`
+	Channels map[string]*channelStats `json:"channels"`
+}
+
+var (
+	STATS = deletionStats{
+		Since:    time.Now().UTC(),
+		Channels: make(map[string]*channelStats),
+	}
+	STATS_LOCK  sync.Mutex
+	STATS_DIRTY bool
+)
+
+func initStats() {
+	if STATS_FILE == "" {
+		return
+	}
+	loadStats()
+	go func() {
+		for range time.Tick(statsSaveInterval) {
+			saveStats()
+		}
+	}()
+}
+
+// loadStats loads the stats from STATS_FILE if it exists.
+func loadStats() {
+	data, err := ioutil.ReadFile(STATS_FILE)
+	if err != nil && !os.IsNotExist(err) {
+		fatal("ReadFile(%s) failed: %v", STATS_FILE, err)
+	}
+	if err == nil {
+		var s deletionStats
+		if err := json.Unmarshal(data, &s); err != nil {
+			fatal("Unmarshal(%s) failed: %v", STATS_FILE, err)
+		}
+		if s.Channels == nil {
+			s.Channels = make(map[string]*channelStats)
+		}
+		STATS = s
+		info("Stats since %v are loaded from %s", s.Since, STATS_FILE)
+	}
+}
+
+// statsCommand prints the stats saved in STATS_FILE.  Channels are shown by
+// their IDs since it doesn't connect to Slack.
+func statsCommand() {
+	if STATS_FILE == "" {
+		fatal("--stats-file is required")
+	}
+	log.out = os.Stderr
+	loadStats()
+	s, err := adminStats(nil)
+	if err != nil {
+		fatal("%v", err)
+	}
+	fmt.Println(s)
+}
+
+// saveStats writes the stats to STATS_FILE if they have changed.
+func saveStats() {
+	if STATS_FILE == "" {
+		return
+	}
+	STATS_LOCK.Lock()
+	defer STATS_LOCK.Unlock()
+	if !STATS_DIRTY {
+		return
+	}
+	data, err := json.MarshalIndent(&STATS, "", "\t")
+	if err != nil {
+		errorlog("MarshalIndent stats failed: %v", err)
+		return
+	}
+	tmp := STATS_FILE + ".tmp"
+	err = ioutil.WriteFile(tmp, append(data, '\n'), 0600)
+	if err == nil {
+		err = os.Rename(tmp, STATS_FILE)
+	}
+	if err != nil {
+		errorlog("Saving stats to %s failed: %v", STATS_FILE, err)
+		return
+	}
+	STATS_DIRTY = false
+}
+
+// recordStats adds d to the stats of ch and the total.
+func recordStats(ch string, d channelStats) {
+	STATS_LOCK.Lock()
+	defer STATS_LOCK.Unlock()
+	s, ok := STATS.Channels[ch]
+	if !ok {
+		s = &channelStats{}
+		STATS.Channels[ch] = s
+	}
+	for _, s := range []*channelStats{s, &STATS.Total} {
+		s.Messages += d.Messages
+		s.Files += d.Files
+		s.FileBytes += d.FileBytes
+		s.Failures += d.Failures
+	}
+	STATS_DIRTY = true
+}
+
+// statsOf returns a copy of the stats.
+func statsOf() deletionStats {
+	STATS_LOCK.Lock()
+	defer STATS_LOCK.Unlock()
+	s := STATS
+	s.Channels = make(map[string]*channelStats, len(STATS.Channels))
+	for ch, cs := range STATS.Channels {
+		c := *cs
+		s.Channels[ch] = &c
+	}
+	return s
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func adminStats(args []string) (string, error) {
+	s := statsOf()
+	if len(args) == 1 {
+		id, name, err := resolveChannel(args[0])
+		if err != nil {
+			return "", err
+		}
+		cs, ok := s.Channels[id]
+		if !ok {
+			cs = &channelStats{}
+		}
+		return fmt.Sprintf("#%s since %s: %v", name, s.Since.Format(time.RFC3339), cs), nil
+	}
+	if len(args) != 0 {
+		return "", fmt.Errorf("wrong number of arguments")
+	}
+	names := make(map[string]string)
+	for _, ch := range getKnownChannels() {
+		names[ch.ID] = ch.Name
+	}
+	ids := make([]string, 0, len(s.Channels))
+	for id := range s.Channels {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return s.Channels[ids[i]].Messages > s.Channels[ids[j]].Messages })
+	var b strings.Builder
+	fmt.Fprintf(&b, "since %s: %v", s.Since.Format(time.RFC3339), &s.Total)
+	for _, id := range ids {
+		name := id
+		if n, ok := names[id]; ok {
+			name = "#" + n
+		}
+		fmt.Fprintf(&b, "\n%s: %v", name, s.Channels[id])
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,174 @@
+package blackhole
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// SummaryConfig is the post_summary option of a channel.
+type SummaryConfig struct {
+	// Every is the duration like "1d" between summaries.
+	Every string `json:"every"`
+
+	// Template is the text of summaries.  {messages}, {files} and {ttl}
+	// are replaced with the numbers of deleted messages and files and the
+	// message TTL.
+	Template string `json:"template,omitempty"`
+}
+
+const defaultSummaryTemplate = ":hole: {messages} messages older than {ttl} were removed"
+
+// summaryState counts deletions in a channel since the last summary.
+type summaryState struct {
+	messages int
+	files    int
+	last     time.Time
+}
+
+var (
+	SUMMARIES      = make(map[string]*summaryState)
+	SUMMARIES_LOCK sync.Mutex
+)
+
+// compile validates post_summary and returns its interval.
+func (c *SummaryConfig) compile() (time.Duration, error) {
+	d, err := parseDuration(c.Every)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("every must be positive")
+	}
+	return d, nil
+}
+
+// humanTTL formats ttl (sec) like "7 days" for summaries.
+func humanTTL(ttl int) string {
+	unit := func(n int, name string) string {
+		if n == 1 {
+			return "1 " + name
+		}
+		return strconv.Itoa(n) + " " + name + "s"
+	}
+	switch {
+	case ttl == 0:
+		return "forever"
+	case ttl%86400 == 0:
+		return unit(ttl/86400, "day")
+	case ttl%3600 == 0:
+		return unit(ttl/3600, "hour")
+	case ttl%60 == 0:
+		return unit(ttl/60, "minute")
+	default:
+		return unit(ttl, "second")
+	}
+}
+
+// ownMessage returns true if msg is posted by slack-blackhole itself.
+func ownMessage(msg *slack.Message) bool {
+	return SELF_USER_ID != "" && msg.User == SELF_USER_ID
+}
+
+// isSummaryPost returns true if msg is a summary posted by post_summary of
+// cfg.  Summaries are never deleted, or deleting them would be summarized
+// again forever.
+func isSummaryPost(cfg Config, msg *slack.Message) bool {
+	if cfg.PostSummary == nil || !ownMessage(msg) {
+		return false
+	}
+	text := cfg.PostSummary.Template
+	if text == "" {
+		text = defaultSummaryTemplate
+	}
+	pattern := strings.NewReplacer(
+		regexp.QuoteMeta("{messages}"), `\d+`,
+		regexp.QuoteMeta("{files}"), `\d+`,
+		regexp.QuoteMeta("{ttl}"), `.+`,
+	).Replace(regexp.QuoteMeta(text))
+	matched, _ := regexp.MatchString("^"+pattern+"$", msg.Text)
+	return matched
+}
+
+// recordSummary counts a deletion in ch for post_summary.
+func recordSummary(ch string, messages, files int) {
+	if channelConfig(ch).PostSummary == nil {
+		return
+	}
+	SUMMARIES_LOCK.Lock()
+	defer SUMMARIES_LOCK.Unlock()
+	s, ok := SUMMARIES[ch]
+	if !ok {
+		s = &summaryState{last: time.Now()}
+		SUMMARIES[ch] = s
+	}
+	s.messages += messages
+	s.files += files
+}
+
+func postSummary(ch string, cfg Config, messages, files int) {
+	if !slackOnly("post_summary", logFields{Action: "summary", Channel: ch}) {
+		return
+	}
+	text := cfg.PostSummary.Template
+	if text == "" {
+		text = defaultSummaryTemplate
+	}
+	text = strings.NewReplacer(
+		"{messages}", strconv.Itoa(messages),
+		"{files}", strconv.Itoa(files),
+		"{ttl}", humanTTL(POLICY.MessageTTL(ch)),
+	).Replace(text)
+	fields := logFields{Action: "summary", Channel: ch}
+	waitAPI("chat.postMessage")
+	_, _, err := RTM.PostMessage(ch, slack.MsgOptionText(text, false))
+	if err != nil {
+		fields.errorlog("PostMessage(%s) failed: %v", ch, err)
+		return
+	}
+	fields.info("Summary posted to %s: %s", ch, text)
+}
+
+// postSummaries posts summaries to channels whose post_summary interval has
+// passed since the last one and which had deletions.
+func postSummaries() {
+	now := time.Now()
+	type post struct {
+		ch              string
+		cfg             Config
+		messages, files int
+	}
+	var posts []post
+	SUMMARIES_LOCK.Lock()
+	for ch, s := range SUMMARIES {
+		cfg := channelConfig(ch)
+		if cfg.PostSummary == nil {
+			delete(SUMMARIES, ch)
+			continue
+		}
+		if now.Sub(s.last) < cfg.summaryEvery {
+			continue
+		}
+		if s.messages > 0 || s.files > 0 {
+			posts = append(posts, post{ch, cfg, s.messages, s.files})
+		}
+		s.messages, s.files, s.last = 0, 0, now
+	}
+	SUMMARIES_LOCK.Unlock()
+	for _, p := range posts {
+		postSummary(p.ch, p.cfg, p.messages, p.files)
+	}
+}
+
+func initSummary() {
+	go func() {
+		for range time.Tick(time.Minute) {
+			postSummaries()
+		}
+	}()
+}
@@ -0,0 +1,287 @@
+package blackhole
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// sweep holds the state of a sweep by inspectPast.  In estimate mode,
+// nothing is scheduled and expired messages and files are only counted.
+// Channels are inspected in parallel, so the counts are guarded by mu.
+type sweep struct {
+	estimate bool
+	names    map[string]string
+
+	mu       sync.Mutex
+	messages map[string]int
+	files    map[string]int
+	admitted int
+	capped   int
+
+	// shadowDiffs is the number of decisions which differ by the shadow
+	// config in each channel.
+	shadowDiffs map[string]int
+
+	// histories has the histories of channels fetched in estimate mode,
+	// which are reused by the sweep following the estimate.
+	histories map[string][]slack.Message
+}
+
+func newSweep(channels []slack.Channel, estimate bool) *sweep {
+	sw := &sweep{
+		estimate: estimate,
+		names:    make(map[string]string),
+		messages: make(map[string]int),
+		files:    make(map[string]int),
+
+		shadowDiffs: make(map[string]int),
+		histories:   make(map[string][]slack.Message),
+	}
+	for _, ch := range channels {
+		sw.names[ch.ID] = ch.Name
+	}
+	return sw
+}
+
+// history returns the whole history of ch.  In estimate mode, it is kept in
+// sw.histories, and a sweep given them by the estimate uses them instead of
+// scanning the channel again.
+func (sw *sweep) history(ch string) ([]slack.Message, error) {
+	sw.mu.Lock()
+	msgs, ok := sw.histories[ch]
+	delete(sw.histories, ch)
+	sw.mu.Unlock()
+	if ok {
+		return msgs, nil
+	}
+	msgs, err := BACKEND.History(ch, "", "")
+	if err == nil && sw.estimate {
+		sw.mu.Lock()
+		sw.histories[ch] = msgs
+		sw.mu.Unlock()
+	}
+	return msgs, err
+}
+
+// admit counts an expired item and returns true if it is to be deleted in
+// this sweep.  sw.mu must be held.
+func (sw *sweep) admit() bool {
+	if sw.estimate {
+		return false
+	}
+	if MAX_DELETIONS_PER_SWEEP > 0 && sw.admitted >= MAX_DELETIONS_PER_SWEEP {
+		sw.capped++
+		return false
+	}
+	sw.admitted++
+	return true
+}
+
+// admitMessage returns true if the message in ch to be deleted at tbd is to
+// be scheduled in this sweep.
+func (sw *sweep) admitMessage(ch string, tbd time.Time) bool {
+	if tbd.After(time.Now()) {
+		return !sw.estimate
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.messages[ch]++
+	return sw.admit()
+}
+
+// admitFile returns true if file is to be scheduled in this sweep.  If force
+// is true, file is counted as expired regardless of its TTL.
+func (sw *sweep) admitFile(file *slack.File, force bool) bool {
+	if len(file.Channels) != 1 {
+		return !sw.estimate
+	}
+	ch := file.Channels[0]
+	if !force {
+		ttl := POLICY.FileTTL(ch)
+		if isCanvas(file) {
+			ttl = 0
+			if CANVASES_BOOKMARKS {
+				ttl = channelConfig(ch).CanvasTTL
+			}
+		}
+		if ttl == 0 || fileDeadline(ch, file, ttl).After(time.Now()) {
+			return !sw.estimate
+		}
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.files[ch]++
+	return sw.admit()
+}
+
+func (sw *sweep) channelName(ch string) string {
+	if name, ok := sw.names[ch]; ok {
+		return "#" + name
+	}
+	return ch
+}
+
+// formatCount formats n with thousands separators like "41,230".
+func formatCount(n int) string {
+	s := fmt.Sprintf("%d", n)
+	var b strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (sw *sweep) total() int {
+	n := 0
+	for _, c := range sw.messages {
+		n += c
+	}
+	for _, c := range sw.files {
+		n += c
+	}
+	return n
+}
+
+func (sw *sweep) report() {
+	verb := "Will delete"
+	if sw.estimate {
+		verb = "Would delete"
+	}
+	var chs []string
+	for ch := range sw.messages {
+		chs = append(chs, ch)
+	}
+	sort.Strings(chs)
+	for _, ch := range chs {
+		logFields{Action: "backlog", Channel: ch}.info("%s %s expired messages in %s", verb, formatCount(sw.messages[ch]), sw.channelName(ch))
+	}
+	chs = nil
+	for ch := range sw.files {
+		chs = append(chs, ch)
+	}
+	sort.Strings(chs)
+	for _, ch := range chs {
+		logFields{Action: "backlog", Channel: ch}.info("%s %s expired files in %s", verb, formatCount(sw.files[ch]), sw.channelName(ch))
+	}
+	if sw.capped > 0 {
+		logFields{Action: "backlog"}.info("%s deletions are postponed to the next sweep by --max-deletions-per-sweep=%d", formatCount(sw.capped), MAX_DELETIONS_PER_SWEEP)
+	}
+	sw.reportShadow()
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmBacklog asks to confirm deletion of the backlog estimated by sw if it
+// is large.  It exits if not confirmed.
+func confirmBacklog(sw *sweep) {
+	total := sw.total()
+	if total < BACKLOG_CONFIRM_THRESHOLD {
+		return
+	}
+	if TUI_MODE || !isTerminal(os.Stdin) {
+		fatal("%s expired messages/files would be deleted.  Set --confirm-backlog to delete them.", formatCount(total))
+	}
+	fmt.Fprintf(os.Stderr, "%s expired messages/files will be deleted.  Proceed? [y/N] ", formatCount(total))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		fatal("Deletion of the backlog is not confirmed")
+	}
+	info("Deletion of the backlog is confirmed")
+}
+
+var (
+	// lastSwept is the time when each channel was swept last.  "" is for
+	// files.
+	lastSwept     = make(map[string]time.Time)
+	lastSweptLock sync.Mutex
+)
+
+func sweepInterval(ch string) time.Duration {
+	if d := channelConfig(ch).sweepInterval; d > 0 {
+		return d
+	}
+	return SWEEP_INTERVAL
+}
+
+// dueForSweep returns true if ch is to be swept at now.  A sweep is recorded
+// unless sw is in estimate mode.
+func (sw *sweep) dueForSweep(ch string, interval time.Duration, now time.Time) bool {
+	lastSweptLock.Lock()
+	defer lastSweptLock.Unlock()
+	last, ok := lastSwept[ch]
+	if ok && now.Sub(last) < interval {
+		return false
+	}
+	if !sw.estimate {
+		lastSwept[ch] = now
+	}
+	return true
+}
+
+// SWEEP_NOW is notified to start a sweep without waiting for the interval.
+var SWEEP_NOW = make(chan struct{}, 1)
+
+// requestSweep starts a sweep of all channels regardless of their sweep
+// intervals as soon as the current sweep, if any, finishes.
+func requestSweep() {
+	lastSweptLock.Lock()
+	lastSwept = make(map[string]time.Time)
+	lastSweptLock.Unlock()
+	select {
+	case SWEEP_NOW <- struct{}{}:
+	default:
+	}
+}
+
+// nextSweepWait returns the duration until the next sweep, which is the
+// shortest sweep interval with random jitter.
+func nextSweepWait() time.Duration {
+	d := SWEEP_INTERVAL
+	CONFIG_LOCK.RLock()
+	for _, cfg := range CONFIG_BY_ID {
+		if cfg.sweepInterval > 0 && cfg.sweepInterval < d {
+			d = cfg.sweepInterval
+		}
+	}
+	CONFIG_LOCK.RUnlock()
+	if SWEEP_JITTER > 0 {
+		d += time.Duration(rand.Int63n(int64(SWEEP_JITTER)))
+	}
+	return d
+}
+
+var (
+	knownChannels     []slack.Channel
+	knownChannelsLock sync.Mutex
+)
+
+// setKnownChannels records the list of channels got on the last sweep.
+func setKnownChannels(channels []slack.Channel) {
+	knownChannelsLock.Lock()
+	defer knownChannelsLock.Unlock()
+	knownChannels = channels
+}
+
+func getKnownChannels() []slack.Channel {
+	knownChannelsLock.Lock()
+	defer knownChannelsLock.Unlock()
+	return knownChannels
+}
@@ -0,0 +1,115 @@
+package blackhole
+
+import (
+	"net/url"
+
+	"github.com/slack-go/slack"
+)
+
+// USER_CLIENT is the client with --slack-user-token, which is used for
+// deletions if set.  RTM with --slack-api-token, which may be a bot token,
+// receives events and does the rest.
+var USER_CLIENT *slack.Client
+
+// USER_CLIENT_USER_ID is the user of USER_CLIENT.
+var USER_CLIENT_USER_ID string
+
+func initUserClient() {
+	if SLACK_USER_TOKEN == "" {
+		return
+	}
+	api := slack.New(SLACK_USER_TOKEN)
+	slack.OptionLog(log)(api)
+	if DEBUG_SLACK {
+		slack.OptionDebug(true)(api)
+	}
+	waitAPI("auth.test")
+	at, err := api.AuthTest()
+	if err != nil {
+		fatal("AuthTest with the user token failed: %v", err)
+	}
+	info("Deletions use the user token of %s", at.User)
+	USER_CLIENT = api
+	USER_CLIENT_USER_ID = at.UserID
+}
+
+// insufficientPrivilege returns true if err means that the token cannot
+// do the operation, which another token may be able to do.
+func insufficientPrivilege(err error) bool {
+	switch err.Error() {
+	case "cant_delete_message", "cant_delete_file", "not_authed", "invalid_auth",
+		"token_revoked", "token_expired", "account_inactive", "missing_scope",
+		"not_allowed_token_type", "restricted_action":
+		return true
+	}
+	return false
+}
+
+// SlackClient is the part of *slack.Client used by SlackDeleter.
+type SlackClient interface {
+	DeleteMessage(channel, ts string) (string, string, error)
+	DeleteFile(id string) error
+}
+
+// SlackDeleter is the Deleter with the Slack Web API.  It deletes with
+// UserClient if set, falling back to Client if the user token lacks the
+// privilege.  Tokens are used for canvases.delete, which slack-go lacks.
+type SlackDeleter struct {
+	Client     SlackClient
+	Token      string
+	UserClient SlackClient
+	UserToken  string
+}
+
+func (d *SlackDeleter) DeleteMessage(ch, ts string) error {
+	if d.UserClient != nil {
+		_, _, err := d.UserClient.DeleteMessage(ch, ts)
+		if err == nil || !insufficientPrivilege(err) {
+			return err
+		}
+		messageLog("delete", ch, ts).info("DeleteMessage(%s, %s) with the user token failed, falling back: %v", ch, ts, err)
+		waitAPI("chat.delete")
+	}
+	_, _, err := d.Client.DeleteMessage(ch, ts)
+	return err
+}
+
+// DeleteFile deletes a file or a canvas in the same way as DeleteMessage.
+func (d *SlackDeleter) DeleteFile(file *slack.File) error {
+	del := func(c SlackClient, token string) error {
+		if isCanvas(file) {
+			return callAPI(token, "canvases.delete", url.Values{"canvas_id": {file.ID}}, nil)
+		}
+		return c.DeleteFile(file.ID)
+	}
+	if d.UserClient != nil {
+		err := del(d.UserClient, d.UserToken)
+		if err == nil || !insufficientPrivilege(err) {
+			return err
+		}
+		fileLog("delete", file.ID).info("Deleting %s with the user token failed, falling back: %v", file.ID, err)
+		waitAPI(fileDeleteMethod(file))
+	}
+	return del(d.Client, d.Token)
+}
+
+// fileDeleteMethod returns the API method to delete file.
+func fileDeleteMethod(file *slack.File) string {
+	if isCanvas(file) {
+		return "canvases.delete"
+	}
+	return "files.delete"
+}
+
+// initDeleter sets DELETER to a SlackDeleter unless it is already set.
+func initDeleter() {
+	if DELETER != nil {
+		return
+	}
+	d := &SlackDeleter{Client: RTM, Token: SLACK_API_TOKEN}
+	if USER_CLIENT != nil {
+		d.UserClient = USER_CLIENT
+		d.UserToken = SLACK_USER_TOKEN
+	}
+	DELETER = d
+}
@@ -0,0 +1,57 @@
+package blackhole
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestSlackDeleterUsesUserClient(t *testing.T) {
+	bot, user := &mockSlackClient{}, &mockSlackClient{}
+	d := &SlackDeleter{Client: bot, UserClient: user}
+	if err := d.DeleteMessage("C1", "1.0"); err != nil {
+		t.Fatalf("DeleteMessage() failed: %v", err)
+	}
+	if err := d.DeleteFile(&slack.File{ID: "F1"}); err != nil {
+		t.Fatalf("DeleteFile() failed: %v", err)
+	}
+	if msgs, files := user.deleted(); len(msgs) != 1 || len(files) != 1 {
+		t.Errorf("user client deleted %v and %v, want 1 message and 1 file", msgs, files)
+	}
+	if msgs, files := bot.deleted(); len(msgs) != 0 || len(files) != 0 {
+		t.Errorf("bot client deleted %v and %v, want nothing", msgs, files)
+	}
+}
+
+func TestSlackDeleterFallsBack(t *testing.T) {
+	bot := &mockSlackClient{}
+	user := &mockSlackClient{err: errors.New("cant_delete_message")}
+	d := &SlackDeleter{Client: bot, UserClient: user}
+	if err := d.DeleteMessage("C1", "1.0"); err != nil {
+		t.Fatalf("DeleteMessage() failed: %v", err)
+	}
+	if msgs, _ := bot.deleted(); len(msgs) != 1 || msgs[0] != "C1/1.0" {
+		t.Errorf("bot client deleted %v, want [C1/1.0]", msgs)
+	}
+}
+
+func TestSlackDeleterDoesNotFallBackOnOtherErrors(t *testing.T) {
+	bot := &mockSlackClient{}
+	user := &mockSlackClient{err: errors.New("ratelimited")}
+	d := &SlackDeleter{Client: bot, UserClient: user}
+	if err := d.DeleteFile(&slack.File{ID: "F1"}); err == nil || err.Error() != "ratelimited" {
+		t.Errorf("DeleteFile() returned %v, want ratelimited", err)
+	}
+	if _, files := bot.deleted(); len(files) != 0 {
+		t.Errorf("bot client deleted %v, want nothing", files)
+	}
+}
+
+func TestSlackDeleterWithoutUserClient(t *testing.T) {
+	bot := &mockSlackClient{err: errors.New("cant_delete_message")}
+	d := &SlackDeleter{Client: bot}
+	if err := d.DeleteMessage("C1", "1.0"); err == nil || err.Error() != "cant_delete_message" {
+		t.Errorf("DeleteMessage() returned %v, want cant_delete_message", err)
+	}
+}
@@ -0,0 +1,58 @@
+package blackhole
+
+import (
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func isTombstone(msg *slack.Message) bool {
+	return msg.SubType == "tombstone"
+}
+
+// hasReplies returns true if the thread of msg has any reply.
+func hasReplies(ch string, msg *slack.Message) (bool, error) {
+	waitAPI("conversations.replies")
+	msgs, _, _, err := RTM.GetConversationReplies(&slack.GetConversationRepliesParameters{
+		ChannelID: ch,
+		Timestamp: msg.Timestamp,
+		Limit:     2,
+	})
+	if err != nil {
+		return false, err
+	}
+	for i := range msgs {
+		if msgs[i].Timestamp != msg.Timestamp {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// cleanupTombstones deletes tombstones ("This message was deleted.") of
+// thread parents whose replies are all gone.
+func cleanupTombstones(ch string, msgs []slack.Message, sw *sweep) {
+	if !CLEANUP_TOMBSTONES || sw.estimate {
+		return
+	}
+	for i := range msgs {
+		msg := &msgs[i]
+		if !isTombstone(msg) {
+			continue
+		}
+		fields := messageLog("tombstone", ch, msg.Timestamp)
+		replies, err := hasReplies(ch, msg)
+		if err != nil {
+			fields.errorlog("GetConversationReplies(%s, %s) failed: %v", ch, msg.Timestamp, err)
+			continue
+		}
+		if replies {
+			continue
+		}
+		if !sw.admitMessage(ch, time.Time{}) {
+			continue
+		}
+		fields.info("Tombstone %s(%s) has no replies", ch, msg.Timestamp)
+		deleteMessage(ch, msg, 0)
+	}
+}
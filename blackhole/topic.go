@@ -0,0 +1,201 @@
+package blackhole
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// directiveRe matches a TTL directive like "[blackhole: 72h]" in the topic
+// or the purpose of a channel.
+var directiveRe = regexp.MustCompile(`(?i)\[blackhole:\s*([^\]]*)\]`)
+
+// directiveSource is the topic or the purpose of a channel and the user who
+// set it.
+type directiveSource struct {
+	text string
+	by   string
+}
+
+// channelText is the topic and the purpose of a channel and the creator of
+// the channel.
+type channelText struct {
+	creator string
+	topic   directiveSource
+	purpose directiveSource
+}
+
+var (
+	// TOPIC_TTLS has the TTLs (sec) given by the directives in topics or
+	// purposes of channels.
+	TOPIC_TTLS   = make(map[string]int)
+	CHANNEL_TEXT = make(map[string]channelText)
+	TOPIC_LOCK   sync.Mutex
+
+	// DIRECTIVE_ADMINS caches whether users who set directives are
+	// admins.
+	DIRECTIVE_ADMINS      = make(map[string]bool)
+	DIRECTIVE_ADMINS_LOCK sync.Mutex
+)
+
+func initTopicDirectives() {
+	switch TOPIC_DIRECTIVE_PRECEDENCE {
+	case "config", "topic":
+	default:
+		fatal("Unknown topic directive precedence: %s", TOPIC_DIRECTIVE_PRECEDENCE)
+	}
+}
+
+// parseDirective returns the TTL (sec) given by the directive in s.  ok is
+// false if s has no valid directive.
+func parseDirective(s string) (int, bool, error) {
+	m := directiveRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false, nil
+	}
+	d, err := parseDuration(strings.TrimSpace(m[1]))
+	if err != nil {
+		return 0, false, err
+	}
+	ttl := int(d / time.Second)
+	if ttl <= 0 {
+		return 0, false, fmt.Errorf("TTL must be positive: %s", strings.TrimSpace(m[1]))
+	}
+	return ttl, true, nil
+}
+
+// directiveAllowed returns true if a directive set by user in a channel
+// created by creator is honored.  Only the creator of the channel and admins
+// can set directives.
+func directiveAllowed(creator, user string) bool {
+	if user == "" {
+		return false
+	}
+	if user == creator {
+		return true
+	}
+	if RTM == nil {
+		return false
+	}
+	DIRECTIVE_ADMINS_LOCK.Lock()
+	admin, ok := DIRECTIVE_ADMINS[user]
+	DIRECTIVE_ADMINS_LOCK.Unlock()
+	if ok {
+		return admin
+	}
+	admin, err := isAdmin(user)
+	if err != nil {
+		logFields{Action: "topic"}.errorlog("Checking if %s is an admin failed: %v", user, err)
+		return false
+	}
+	DIRECTIVE_ADMINS_LOCK.Lock()
+	DIRECTIVE_ADMINS[user] = admin
+	DIRECTIVE_ADMINS_LOCK.Unlock()
+	return admin
+}
+
+// setChannelTextOf records the topic and the purpose of ch.
+func setChannelTextOf(ch slack.Channel) {
+	setChannelText(ch.ID, ch.Creator,
+		&directiveSource{ch.Topic.Value, ch.Topic.Creator},
+		&directiveSource{ch.Purpose.Value, ch.Purpose.Creator})
+}
+
+// setChannelText records the topic and the purpose of ch and updates the TTL
+// given by the directive in them.  The topic takes precedence over the
+// purpose.  nil or "" leaves the text or the creator unchanged.
+func setChannelText(ch, creator string, topic, purpose *directiveSource) {
+	if !TOPIC_DIRECTIVES {
+		return
+	}
+	TOPIC_LOCK.Lock()
+	t := CHANNEL_TEXT[ch]
+	if creator != "" {
+		t.creator = creator
+	}
+	if topic != nil {
+		t.topic = *topic
+	}
+	if purpose != nil {
+		t.purpose = *purpose
+	}
+	CHANNEL_TEXT[ch] = t
+	TOPIC_LOCK.Unlock()
+
+	fields := logFields{Action: "topic", Channel: ch}
+	ttl, found := 0, false
+	for _, s := range []directiveSource{t.topic, t.purpose} {
+		v, ok, err := parseDirective(s.text)
+		if err != nil {
+			fields.errorlog("Invalid directive in channel %s is ignored: %v", ch, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := checkMinTTL("directive TTL", v); err != nil {
+			fields.errorlog("Directive in channel %s is ignored: %v", ch, err)
+			continue
+		}
+		if !directiveAllowed(t.creator, s.by) {
+			fields.errorlog("Directive in channel %s is ignored: it is set by %s, who is neither the creator of the channel nor an admin", ch, s.by)
+			continue
+		}
+		ttl, found = v, true
+		break
+	}
+
+	TOPIC_LOCK.Lock()
+	defer TOPIC_LOCK.Unlock()
+	old, had := TOPIC_TTLS[ch]
+	if found {
+		TOPIC_TTLS[ch] = ttl
+	} else {
+		delete(TOPIC_TTLS, ch)
+	}
+	if ttl, ok := TOPIC_TTLS[ch]; ok && (!had || ttl != old) {
+		logFields{Action: "topic", Channel: ch}.info("Channel %s has TTL %s by the directive", ch, formatTTL(ttl))
+	} else if !ok && had {
+		logFields{Action: "topic", Channel: ch}.info("Channel %s no longer has a directive", ch)
+	}
+}
+
+// handleTopicChange handles a message about a change of the topic or the
+// purpose of ch.
+func handleTopicChange(ch string, msg *slack.Message) {
+	switch msg.SubType {
+	case "channel_topic", "group_topic":
+		setChannelText(ch, "", &directiveSource{msg.Topic, msg.User}, nil)
+	case "channel_purpose", "group_purpose":
+		setChannelText(ch, "", nil, &directiveSource{msg.Purpose, msg.User})
+	}
+}
+
+// topicTTL returns the TTL (sec) given by the directive in ch.
+func topicTTL(ch string) (int, bool) {
+	TOPIC_LOCK.Lock()
+	defer TOPIC_LOCK.Unlock()
+	ttl, ok := TOPIC_TTLS[ch]
+	return ttl, ok
+}
+
+// directiveTTL returns the TTL to use instead of cfgttl (sec) from the
+// config file.  The directive overrides the default TTL and, with
+// --topic-directive-precedence=topic, the TTL in the config file.
+func directiveTTL(ch string, cfgttl, defttl int) int {
+	if ttl, ok := topicTTL(ch); ok {
+		if cfgttl == 0 || TOPIC_DIRECTIVE_PRECEDENCE == "topic" {
+			return ttl
+		}
+	}
+	return effectiveTTL(cfgttl, defttl)
+}
+
+func messageTTL(ch string) int {
+	cfg := channelConfig(ch)
+	return cfg.calendarTTL(directiveTTL(ch, cfg.MessageTTL, DEFAULT_MESSAGE_TTL))
+}
@@ -0,0 +1,221 @@
+package blackhole
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// span is a span of OpenTelemetry traces.  A nil *span is a no-op so that
+// callers don't have to care whether tracing is enabled.
+type span struct {
+	mu       sync.Mutex
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+	attrs    map[string]string
+	errMsg   string
+}
+
+// tracer batches ended spans and exports them to OTLP_ENDPOINT by OTLP/HTTP
+// with JSON encoding.
+type tracer struct {
+	mu     sync.Mutex
+	spans  []otlpSpan
+	client *http.Client
+}
+
+// TRACER is nil if tracing is disabled.
+var TRACER *tracer
+
+// maxBufferedSpans is the number of spans buffered before export.  Spans
+// beyond it are dropped while the collector is unavailable.
+const maxBufferedSpans = 10000
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startSpan starts a span.  It starts a new trace if parent is nil.  attrs
+// are pairs of keys and values.
+func startSpan(name string, parent *span, attrs ...string) *span {
+	if TRACER == nil {
+		return nil
+	}
+	s := &span{
+		spanID: randomHex(8),
+		name:   name,
+		start:  time.Now(),
+		attrs:  make(map[string]string),
+	}
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		s.traceID = randomHex(16)
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.attrs[attrs[i]] = attrs[i+1]
+	}
+	return s
+}
+
+func (s *span) setAttr(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs[key] = value
+}
+
+func (s *span) setError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errMsg = err.Error()
+}
+
+func (s *span) end() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	o := otlpSpan{
+		TraceID:      s.traceID,
+		SpanID:       s.spanID,
+		ParentSpanID: s.parentID,
+		Name:         s.name,
+		Kind:         1, // SPAN_KIND_INTERNAL
+		Start:        strconv.FormatInt(s.start.UnixNano(), 10),
+		End:          strconv.FormatInt(time.Now().UnixNano(), 10),
+	}
+	for k, v := range s.attrs {
+		o.Attributes = append(o.Attributes, otlpAttr{Key: k, Value: otlpValue{StringValue: v}})
+	}
+	if s.errMsg != "" {
+		o.Status = &otlpStatus{Code: 2, Message: s.errMsg} // STATUS_CODE_ERROR
+	}
+	s.mu.Unlock()
+
+	TRACER.mu.Lock()
+	defer TRACER.mu.Unlock()
+	if len(TRACER.spans) < maxBufferedSpans {
+		TRACER.spans = append(TRACER.spans, o)
+	}
+}
+
+// OTLP JSON types.  See opentelemetry-proto for the definitions.
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID      string      `json:"traceId"`
+	SpanID       string      `json:"spanId"`
+	ParentSpanID string      `json:"parentSpanId,omitempty"`
+	Name         string      `json:"name"`
+	Kind         int         `json:"kind"`
+	Start        string      `json:"startTimeUnixNano"`
+	End          string      `json:"endTimeUnixNano"`
+	Attributes   []otlpAttr  `json:"attributes,omitempty"`
+	Status       *otlpStatus `json:"status,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// export sends the buffered spans.  They are kept for the next export if
+// the collector is unavailable.
+func (t *tracer) export() error {
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	var rs otlpResourceSpans
+	rs.Resource.Attributes = []otlpAttr{{Key: "service.name", Value: otlpValue{StringValue: OTLP_SERVICE_NAME}}}
+	var ss otlpScopeSpans
+	ss.Scope.Name = "slack-blackhole"
+	ss.Spans = spans
+	rs.ScopeSpans = []otlpScopeSpans{ss}
+	data, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{rs}})
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		res, err := t.client.Post(OTLP_ENDPOINT, "application/json", bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode/100 != 2 {
+			return fmt.Errorf("collector returned %s", res.Status)
+		}
+		return nil
+	}()
+	if err != nil {
+		t.mu.Lock()
+		if len(t.spans)+len(spans) <= maxBufferedSpans {
+			t.spans = append(spans, t.spans...)
+		}
+		t.mu.Unlock()
+	}
+	return err
+}
+
+func initTracing() {
+	if OTLP_ENDPOINT == "" {
+		return
+	}
+	TRACER = &tracer{client: &http.Client{Timeout: 10 * time.Second}}
+	info("Exporting traces to %s", OTLP_ENDPOINT)
+	go func() {
+		for range time.Tick(5 * time.Second) {
+			if err := TRACER.export(); err != nil {
+				logFields{Action: "trace"}.errorlog("Exporting traces failed: %v", err)
+			}
+		}
+	}()
+}
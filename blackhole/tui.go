@@ -0,0 +1,335 @@
+package blackhole
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// maxTUIEvents is the number of recent events shown by --tui.
+const maxTUIEvents = 50
+
+// tuiRefreshInterval is how often the dashboard of --tui is redrawn.
+const tuiRefreshInterval = time.Second
+
+// tui is the dashboard of --tui drawn with ANSI escape sequences.  Keys are
+// read from the terminal in cbreak mode set by stty, or line by line if
+// stty is not available.
+type tui struct {
+	mu       sync.Mutex
+	events   []string
+	selected int
+	message  string
+	stty     string
+	stopped  bool
+}
+
+// TUI is the dashboard if --tui is set.
+var TUI *tui
+
+func startTUI() {
+	t := &tui{}
+	// logs would break the dashboard unless stderr is redirected
+	log.mu.Lock()
+	if isTerminal(os.Stderr) {
+		log.out = ioutil.Discard
+	} else {
+		log.out = os.Stderr
+	}
+	log.mu.Unlock()
+	if out, err := stty("-g"); err == nil {
+		t.stty = strings.TrimSpace(out)
+		stty("cbreak", "-echo")
+	}
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	TUI = t
+	go t.readKeys()
+	go func() {
+		for {
+			t.draw()
+			time.Sleep(tuiRefreshInterval)
+		}
+	}()
+}
+
+// stopTUI restores the terminal.  It is safe to call without --tui.
+func stopTUI() {
+	t := TUI
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	t.stopped = true
+	fmt.Print("\x1b[?25h\x1b[?1049l")
+	if t.stty != "" {
+		stty(t.stty)
+	}
+	log.mu.Lock()
+	log.out = os.Stderr
+	log.mu.Unlock()
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// recordEvent adds ev to the events shown by --tui.
+func recordEvent(ev interface{}) {
+	t := TUI
+	if t == nil {
+		return
+	}
+	var s string
+	switch ev := ev.(type) {
+	case *slack.MessageEvent:
+		s = fmt.Sprintf("message %s %s %s", channelName(ev.Channel), ev.Timestamp, ev.SubType)
+	case *slack.FileCreatedEvent:
+		s = "file_created " + ev.FileID
+	case *slack.FileSharedEvent:
+		s = "file_shared " + ev.FileID
+	default:
+		s = strings.TrimPrefix(fmt.Sprintf("%T", ev), "*slack.")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, time.Now().Format("15:04:05")+" "+s)
+	if len(t.events) > maxTUIEvents {
+		t.events = t.events[1:]
+	}
+}
+
+// channelName returns "#name" of ch if it is known, or ch.
+func channelName(ch string) string {
+	for _, c := range getKnownChannels() {
+		if c.ID == ch {
+			return "#" + c.Name
+		}
+	}
+	return ch
+}
+
+func tuiChannels() []slack.Channel {
+	channels := append([]slack.Channel{}, getKnownChannels()...)
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	return channels
+}
+
+// readKeys handles keys: j/k or arrows select a channel, p pauses or
+// resumes it, s starts a sweep and q quits.
+func (t *tui) readKeys() {
+	r := bufio.NewReader(os.Stdin)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		if b == 0x1b {
+			// arrow keys are ESC [ A and ESC [ B
+			if c, _ := r.ReadByte(); c != '[' {
+				continue
+			}
+			switch c, _ := r.ReadByte(); c {
+			case 'A':
+				b = 'k'
+			case 'B':
+				b = 'j'
+			}
+		}
+		t.handleKey(b)
+		t.draw()
+	}
+}
+
+func (t *tui) handleKey(b byte) {
+	channels := tuiChannels()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch b {
+	case 'j':
+		if t.selected < len(channels)-1 {
+			t.selected++
+		}
+	case 'k':
+		if t.selected > 0 {
+			t.selected--
+		}
+	case 'p':
+		if t.selected >= len(channels) {
+			return
+		}
+		ch := channels[t.selected]
+		if pauseChannel(ch.ID) {
+			t.message = "Paused #" + ch.Name
+		} else {
+			resumeChannel(ch.ID)
+			t.message = "Resumed #" + ch.Name
+		}
+	case 's':
+		requestSweep()
+		t.message = "Sweep requested"
+	case 'q':
+		go func() {
+			stopTUI()
+			info("Quit by the TUI; stopping")
+			shutdown()
+		}()
+	}
+}
+
+// terminalSize returns the number of rows and columns of the terminal, or
+// 24x80 if unknown.
+func terminalSize() (int, int) {
+	out, err := stty("size")
+	if err == nil {
+		f := strings.Fields(out)
+		if len(f) == 2 {
+			rows, err1 := strconv.Atoi(f[0])
+			cols, err2 := strconv.Atoi(f[1])
+			if err1 == nil && err2 == nil && rows > 0 && cols > 0 {
+				return rows, cols
+			}
+		}
+	}
+	return 24, 80
+}
+
+func (t *tui) draw() {
+	rows, cols := terminalSize()
+	channels := tuiChannels()
+	items := pendingItems()
+	errs := log.errors()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	// header, 4 panel titles and footer
+	n := (rows - 6) / 4
+	if n < 1 {
+		n = 1
+	}
+	var lines []string
+	styled := func(style, s string) {
+		if len(s) > cols {
+			s = s[:cols]
+		}
+		if style != "" {
+			s = style + s + "\x1b[0m"
+		}
+		lines = append(lines, s)
+	}
+	add := func(s string) { styled("", s) }
+	title := func(s string) {
+		styled("\x1b[7m", s+strings.Repeat(" ", max0(cols-len(s))))
+	}
+	now := time.Now()
+
+	add(fmt.Sprintf("slack-blackhole  %s  %d pending  %s", now.Format("2006-01-02 15:04:05"), len(items), t.message))
+
+	title("Events")
+	events := t.events
+	if len(events) > n {
+		events = events[len(events)-n:]
+	}
+	for i := 0; i < n; i++ {
+		if i < len(events) {
+			add(events[i])
+		} else {
+			add("")
+		}
+	}
+
+	title(fmt.Sprintf("Queue (%d)", len(items)))
+	for i := 0; i < n; i++ {
+		if i >= len(items) {
+			add("")
+			continue
+		}
+		p := items[i]
+		target := p.TS
+		if p.Kind != "message" {
+			target = p.File
+		}
+		due := p.DueAt.Sub(now).Truncate(time.Second)
+		if due < 0 {
+			due = 0
+		}
+		add(fmt.Sprintf("%-10s %-8s %-20s %-18s %s", due, p.Kind, channelName(p.Channel), target, p.State))
+	}
+
+	title("Channels  [j/k] select  [p] pause/resume  [s] sweep  [q] quit")
+	if t.selected >= len(channels) {
+		t.selected = max0(len(channels) - 1)
+	}
+	first := 0
+	if t.selected >= n {
+		first = t.selected - n + 1
+	}
+	for i := first; i < first+n; i++ {
+		if i >= len(channels) {
+			add("")
+			continue
+		}
+		ch := channels[i]
+		state := "-"
+		switch {
+		case isPaused(ch.ID):
+			state = "paused"
+		case POLICY.Managed(ch.ID):
+			state = "managed"
+		}
+		s := fmt.Sprintf("%-24s %-8s message %-10s file %-10s", "#"+ch.Name, state, formatTTL(POLICY.MessageTTL(ch.ID)), formatTTL(POLICY.FileTTL(ch.ID)))
+		if i == t.selected {
+			styled("\x1b[1m", "> "+s)
+		} else {
+			add("  " + s)
+		}
+	}
+
+	title(fmt.Sprintf("Errors (%d)", len(errs)))
+	if len(errs) > n {
+		errs = errs[len(errs)-n:]
+	}
+	for i := 0; i < n; i++ {
+		if i < len(errs) {
+			e := errs[i]
+			ts, _ := time.Parse(time.RFC3339Nano, e.Time)
+			add(ts.Local().Format("15:04:05") + " " + e.Message)
+		} else {
+			add("")
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for _, l := range lines {
+		b.WriteString(l)
+		b.WriteString("\x1b[K\r\n")
+	}
+	b.WriteString("\x1b[J")
+	fmt.Print(b.String())
+}
+
+func max0(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
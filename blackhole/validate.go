@@ -0,0 +1,169 @@
+package blackhole
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// configProblem is a problem in the config file found by validate.
+type configProblem struct {
+	offset int64
+	msg    string
+}
+
+// position returns "line:column" of offset in data.
+func position(data []byte, offset int64) string {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line, col := 1, 1
+	for _, c := range data[:offset] {
+		if c == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return fmt.Sprintf("%d:%d", line, col)
+}
+
+// skipSpace returns the offset of the first byte in data at or after offset
+// which is not a white space nor a comma.
+func skipSpace(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) {
+		switch data[offset] {
+		case ' ', '\t', '\r', '\n', ',':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// jsonErrorOffset returns the offset of err in the decoded input if known.
+func jsonErrorOffset(err error) (int64, bool) {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return syntaxErr.Offset, true
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return typeErr.Offset, true
+	}
+	return 0, false
+}
+
+// validateConfig checks data of the config file.  channels has the names of
+// existing channels, or is nil if they are unknown.
+func validateConfig(data []byte, channels map[string]bool) []configProblem {
+	var problems []configProblem
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		off, _ := jsonErrorOffset(err)
+		return append(problems, configProblem{off, err.Error()})
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return append(problems, configProblem{0, "the config must be an array of channel entries"})
+	}
+
+	seen := make(map[string]int)
+	for i := 1; dec.More(); i++ {
+		start := skipSpace(data, dec.InputOffset())
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			off, ok := jsonErrorOffset(err)
+			if !ok {
+				off = start
+			}
+			return append(problems, configProblem{off, err.Error()})
+		}
+		report := func(off int64, format string, args ...interface{}) {
+			problems = append(problems, configProblem{off, fmt.Sprintf("entry %d: ", i) + fmt.Sprintf(format, args...)})
+		}
+
+		var cfg Config
+		d := json.NewDecoder(bytes.NewReader(raw))
+		d.DisallowUnknownFields()
+		if err := d.Decode(&cfg); err != nil {
+			off, ok := jsonErrorOffset(err)
+			if !ok {
+				off = 0
+			}
+			report(start+off, "%v", err)
+			continue
+		}
+
+		if cfg.Channel == "" {
+			report(start, "channel is not specified")
+		} else if j, ok := seen[cfg.Channel]; ok {
+			report(start, "channel %s is already configured in entry %d", cfg.Channel, j)
+		} else {
+			seen[cfg.Channel] = i
+			if channels != nil && !channels[cfg.Channel] {
+				report(start, "channel %s is not found", cfg.Channel)
+			}
+		}
+		if cfg.MaxMessages < 0 {
+			report(start, "max_messages must not be negative")
+		}
+		if cfg.MaxFileBytes < 0 {
+			report(start, "max_file_bytes must not be negative")
+		}
+		if err := cfg.compile(); err != nil {
+			report(start, "%v", err)
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		off, _ := jsonErrorOffset(err)
+		return append(problems, configProblem{off, err.Error()})
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		problems = append(problems, configProblem{dec.InputOffset(), "extra data after the config"})
+	}
+	return problems
+}
+
+// validate checks CONFIG_FILE and exits with status 1 if it has problems.
+// Channels are checked to exist if the API token is set.
+func validate() {
+	log.out = os.Stderr
+	if CONFIG_FILE == "" {
+		fatal("--config-file is not specified")
+	}
+	data, err := ioutil.ReadFile(CONFIG_FILE)
+	if err != nil {
+		fatal("ReadFile(%s) failed: %v", CONFIG_FILE, err)
+	}
+
+	var channels map[string]bool
+	if SLACK_API_TOKEN != "" {
+		initApiThrottle()
+		initSlackClient()
+		chs, err := BACKEND.ListConversations()
+		if err != nil {
+			fatal("getting the list of channels failed: %v", err)
+		}
+		channels = make(map[string]bool)
+		for _, ch := range chs {
+			channels[ch.Name] = true
+		}
+	}
+
+	problems := validateConfig(data, channels)
+	for _, p := range problems {
+		fmt.Printf("%s:%s: %s\n", CONFIG_FILE, position(data, p.offset), p.msg)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+	fmt.Printf("%s: OK\n", CONFIG_FILE)
+}
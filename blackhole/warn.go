@@ -0,0 +1,77 @@
+package blackhole
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// warnDeletion notifies the author of msg that msg will be deleted at tbd by
+// adding warn_reaction to msg, or by an ephemeral message if warn_reaction is
+// not set.
+func warnDeletion(ch string, msg *slack.Message, tbd time.Time) {
+	fields := messageLog("warn", ch, msg.Timestamp)
+	if !slackOnly("warn_before", fields) {
+		return
+	}
+	reaction := channelConfig(ch).WarnReaction
+	if DRY_RUN {
+		fields.info("Warn the deletion of message %s(%s) (dry-run)", ch, msg.Timestamp)
+		return
+	}
+	if reaction != "" {
+		waitAPI("reactions.add")
+		err := RTM.AddReaction(reaction, slack.NewRefToMessage(ch, msg.Timestamp))
+		if err != nil {
+			fields.errorlog("AddReaction(%s, %s, %s) failed: %v", reaction, ch, msg.Timestamp, err)
+			return
+		}
+		fields.info("Warned the deletion of message %s(%s) with :%s:", ch, msg.Timestamp, reaction)
+		return
+	}
+
+	if msg.User == "" {
+		return
+	}
+	text := fmt.Sprintf("Your message will be deleted at <!date^%d^{date_short_pretty} {time}|%s>. Copy it if you need it.",
+		tbd.Unix(), tbd.UTC().Format(time.RFC1123))
+	opts := []slack.MsgOption{slack.MsgOptionText(text, false)}
+	if msg.ThreadTimestamp != "" {
+		opts = append(opts, slack.MsgOptionTS(msg.ThreadTimestamp))
+	}
+	waitAPI("chat.postEphemeral")
+	_, err := RTM.PostEphemeral(ch, msg.User, opts...)
+	if err != nil {
+		fields.errorlog("PostEphemeral(%s, %s) failed: %v", ch, msg.User, err)
+		return
+	}
+	fields.info("Warned the deletion of message %s(%s) to %s", ch, msg.Timestamp, msg.User)
+}
+
+// waitWarnTime blocks until warn_before of ch before DueAt of p, which may
+// be moved earlier while waiting, and warns the deletion of msg.  It does
+// nothing if DueAt has already passed or the deletion is canceled.
+func waitWarnTime(ch string, msg *slack.Message, p *pendingItem) {
+	w := channelConfig(ch).warnBefore
+	if w <= 0 {
+		return
+	}
+	for {
+		tbd, _ := p.status()
+		if !tbd.After(time.Now()) {
+			return
+		}
+		select {
+		case <-time.After(tbd.Add(-w).Sub(time.Now())):
+			if p.isCanceled() {
+				return
+			}
+			warnDeletion(ch, msg, tbd)
+			return
+		case <-p.earlier:
+		case <-p.canceled:
+			return
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package blackhole
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timeWindow is a daily time window like "02:00-05:00".  The window may span
+// midnight like "22:00-05:00".
+type timeWindow struct {
+	start time.Duration
+	end   time.Duration
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: %w", s, err)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func parseTimeWindow(s string) (*timeWindow, error) {
+	clocks := strings.Split(s, "-")
+	if len(clocks) != 2 {
+		return nil, fmt.Errorf("invalid time window %q", s)
+	}
+	w := &timeWindow{}
+	var err error
+	w.start, err = parseClock(strings.TrimSpace(clocks[0]))
+	if err != nil {
+		return nil, err
+	}
+	w.end, err = parseClock(strings.TrimSpace(clocks[1]))
+	if err != nil {
+		return nil, err
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("empty time window %q", s)
+	}
+	return w, nil
+}
+
+// wait returns the duration from t until the window opens.  It returns 0 if
+// t is in the window.  The window is of the wall clock, so the duration
+// isn't adjusted on DST days.
+func (w *timeWindow) wait(t time.Time) time.Duration {
+	off := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	var in bool
+	if w.start < w.end {
+		in = w.start <= off && off < w.end
+	} else {
+		in = w.start <= off || off < w.end
+	}
+	if in {
+		return 0
+	}
+	if off < w.start {
+		return w.start - off
+	}
+	return 24*time.Hour - off + w.start
+}
+
+var DELETE_WINDOW_LOCATION *time.Location
+
+func initDeleteWindow() {
+	loc, err := time.LoadLocation(DELETE_WINDOW_TZ)
+	if err != nil {
+		fatal("LoadLocation(%s) failed: %v", DELETE_WINDOW_TZ, err)
+	}
+	DELETE_WINDOW_LOCATION = loc
+	if DELETE_WINDOW != "" {
+		if _, err := parseTimeWindow(DELETE_WINDOW); err != nil {
+			fatal("Invalid --delete-window: %v", err)
+		}
+		info("Deletions are executed only in %s (%s)", DELETE_WINDOW, DELETE_WINDOW_TZ)
+	}
+}
+
+// deleteWindow returns the deletion window of ch or nil if deletions in ch
+// are allowed at any time.
+func deleteWindow(ch string) *timeWindow {
+	s := channelConfig(ch).DeleteWindow
+	if s == "" {
+		s = DELETE_WINDOW
+	}
+	if s == "" {
+		return nil
+	}
+	w, err := parseTimeWindow(s)
+	if err != nil {
+		// validated on loading; should not happen
+		errorlog("parseTimeWindow(%s) for %s failed: %v", s, ch, err)
+		return nil
+	}
+	return w
+}
+
+// inDeleteWindow returns true if deletions in ch are allowed now.
+func inDeleteWindow(ch string) bool {
+	w := deleteWindow(ch)
+	return w == nil || w.wait(time.Now().In(DELETE_WINDOW_LOCATION)) == 0
+}
+
+// waitDeleteWindow blocks until the deletion window of ch opens.
+func waitDeleteWindow(ch string, fields logFields) {
+	w := deleteWindow(ch)
+	if w == nil {
+		return
+	}
+	d := w.wait(time.Now().In(DELETE_WINDOW_LOCATION))
+	if d == 0 {
+		return
+	}
+	fields.Action = "window"
+	fields.info("Deletion is queued until the deletion window opens in %v", d)
+	<-time.After(d)
+}
@@ -0,0 +1,66 @@
+package blackhole
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	for _, tc := range []struct {
+		s          string
+		start, end time.Duration
+		ok         bool
+	}{
+		{"02:00-05:00", 2 * time.Hour, 5 * time.Hour, true},
+		{"22:00 - 05:30", 22 * time.Hour, 5*time.Hour + 30*time.Minute, true},
+		{"03:00-03:00", 0, 0, false},
+		{"25:00-03:00", 0, 0, false},
+		{"02:00", 0, 0, false},
+	} {
+		w, err := parseTimeWindow(tc.s)
+		if !tc.ok {
+			if err == nil {
+				t.Errorf("parseTimeWindow(%q) succeeded, want an error", tc.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTimeWindow(%q) failed: %v", tc.s, err)
+			continue
+		}
+		if w.start != tc.start || w.end != tc.end {
+			t.Errorf("parseTimeWindow(%q) = %v-%v, want %v-%v", tc.s, w.start, w.end, tc.start, tc.end)
+		}
+	}
+}
+
+func TestTimeWindowWait(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("LoadLocation() failed: %v", err)
+	}
+	for _, tc := range []struct {
+		window string
+		t      time.Time
+		want   time.Duration
+	}{
+		{"02:00-05:00", time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC), 0},
+		{"02:00-05:00", time.Date(2026, 1, 1, 1, 30, 0, 0, time.UTC), 30 * time.Minute},
+		{"02:00-05:00", time.Date(2026, 1, 1, 6, 0, 0, 0, time.UTC), 20 * time.Hour},
+		{"22:00-05:00", time.Date(2026, 1, 1, 23, 0, 0, 0, time.UTC), 0},
+		{"22:00-05:00", time.Date(2026, 1, 1, 4, 59, 0, 0, time.UTC), 0},
+		{"22:00-05:00", time.Date(2026, 1, 1, 5, 0, 0, 0, time.UTC), 17 * time.Hour},
+		{"22:00-05:00", time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC), 10 * time.Hour},
+		// DST starts at 02:00 on the day
+		{"04:00-05:00", time.Date(2026, 3, 8, 4, 30, 0, 0, ny), 0},
+		{"04:00-05:00", time.Date(2026, 3, 8, 3, 30, 0, 0, ny), 30 * time.Minute},
+	} {
+		w, err := parseTimeWindow(tc.window)
+		if err != nil {
+			t.Fatalf("parseTimeWindow(%q) failed: %v", tc.window, err)
+		}
+		if got := w.wait(tc.t); got != tc.want {
+			t.Errorf("wait(%v) of %s = %v, want %v", tc.t, tc.window, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package blackhole
+
+import (
+	"sync"
+	"time"
+)
+
+// ring has jobs queued per channel, which are taken from the channels in
+// round-robin.
+type ring struct {
+	queues map[string][]func()
+	// order is the ring of channels having queued jobs
+	order []string
+	next  int
+}
+
+func (r *ring) push(ch string, job func()) {
+	if len(r.queues[ch]) == 0 {
+		r.order = append(r.order, ch)
+	}
+	r.queues[ch] = append(r.queues[ch], job)
+}
+
+func (r *ring) pop() func() {
+	if r.next >= len(r.order) {
+		r.next = 0
+	}
+	ch := r.order[r.next]
+	q := r.queues[ch]
+	job := q[0]
+	if len(q) == 1 {
+		delete(r.queues, ch)
+		r.order = append(r.order[:r.next], r.order[r.next+1:]...)
+	} else {
+		r.queues[ch] = q[1:]
+		r.next++
+	}
+	return job
+}
+
+func (r *ring) len() int {
+	n := 0
+	for _, q := range r.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// dispatcher distributes deletion jobs to workers.  Jobs are queued per
+// channel and taken from the channels in round-robin so that a channel
+// having a huge backlog doesn't starve the others.  Jobs of backlog are
+// taken only while no real-time job is queued.
+type dispatcher struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	realtime ring
+	backlog  ring
+	// running is the number of jobs being run by workers
+	running int
+	// stopping is true once stop is called; no more jobs are taken
+	stopping bool
+}
+
+func newDispatcher() *dispatcher {
+	d := &dispatcher{
+		realtime: ring{queues: make(map[string][]func())},
+		backlog:  ring{queues: make(map[string][]func())},
+	}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+func (d *dispatcher) submit(ch string, backlog bool, job func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if backlog {
+		d.backlog.push(ch, job)
+	} else {
+		d.realtime.push(ch, job)
+	}
+	d.cond.Signal()
+}
+
+// take blocks until a job is available and returns it.  The job is counted
+// as running until done is called.  It blocks forever once stop is called.
+func (d *dispatcher) take() func() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for d.stopping || len(d.realtime.order) == 0 && len(d.backlog.order) == 0 {
+		d.cond.Wait()
+	}
+	d.running++
+	if len(d.realtime.order) > 0 {
+		return d.realtime.pop()
+	}
+	return d.backlog.pop()
+}
+
+// done tells that a job returned by take is done.
+func (d *dispatcher) done() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.running--
+}
+
+// stop stops workers from taking jobs, and waits up to timeout for the
+// running jobs to be done.  It returns the numbers of the jobs still running
+// and of those left queued.
+func (d *dispatcher) stop(timeout time.Duration) (int, int) {
+	d.mu.Lock()
+	d.stopping = true
+	d.mu.Unlock()
+	deadline := time.Now().Add(timeout)
+	for {
+		d.mu.Lock()
+		running, queued := d.running, d.realtime.len()+d.backlog.len()
+		d.mu.Unlock()
+		if running == 0 || !time.Now().Before(deadline) {
+			return running, queued
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// queued returns the number of queued jobs.
+func (d *dispatcher) queued() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.realtime.len() + d.backlog.len()
+}
+
+var DISPATCHER = newDispatcher()
+
+// initDeletionWorkers starts workers which run deletion jobs.  Each job waits
+// for the rate limit of the method, so the workers share it.
+func initDeletionWorkers() {
+	if DELETION_WORKERS < 1 {
+		fatal("--deletion-workers must be positive")
+	}
+	for i := 0; i < DELETION_WORKERS; i++ {
+		go func() {
+			for {
+				DISPATCHER.take()()
+				DISPATCHER.done()
+			}
+		}()
+	}
+}
+
+// submitDeletion queues job to delete the pending item p.
+func submitDeletion(p *pendingItem, job func()) {
+	DISPATCHER.submit(p.Channel, p.Backlog, job)
+}
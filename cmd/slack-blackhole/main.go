@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/ktateish/slack-blackhole/blackhole"
+)
+
+func main() {
+	blackhole.Main()
+}
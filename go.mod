@@ -3,6 +3,7 @@ module github.com/ktateish/slack-blackhole
 go 1.13
 
 require (
+	github.com/gorilla/websocket v1.4.2
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/slack-go/slack v0.8.1
 )